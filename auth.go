@@ -0,0 +1,119 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// An Authenticator adds credentials to each request that a EurekaConnection sends to Eureka.
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// AuthenticatorFunc adapts an ordinary function to the Authenticator interface.
+type AuthenticatorFunc func(req *http.Request) error
+
+// Authenticate calls f(req).
+func (f AuthenticatorFunc) Authenticate(req *http.Request) error {
+	return f(req)
+}
+
+// BasicAuth returns an Authenticator that applies HTTP basic authentication with the given user
+// name and password.
+func BasicAuth(username, password string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		req.SetBasicAuth(username, password)
+		return nil
+	})
+}
+
+func setBearerToken(req *http.Request, token string) {
+	req.Header.Set("Authorization", "Bearer "+token)
+}
+
+// BearerToken returns an Authenticator that presents the given static bearer token.
+func BearerToken(token string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		setBearerToken(req, token)
+		return nil
+	})
+}
+
+// tokenExpiryMargin is how long before a token's expiry we stop using it and fetch a fresh one,
+// allowing for clock skew and time in flight.
+const tokenExpiryMargin = 10 * time.Second
+
+type refreshingBearerToken struct {
+	fetch  func(ctx context.Context) (string, time.Time, error)
+	m      sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// RefreshingBearerToken returns an Authenticator that presents a bearer token obtained from the
+// supplied function, reusing each token until shortly before the expiry time reported with it. A
+// zero expiry time indicates that the token never expires.
+//
+// The function is called with the context of the request awaiting the token, and is never called
+// concurrently by the same Authenticator.
+func RefreshingBearerToken(fetch func(ctx context.Context) (token string, expiry time.Time, err error)) Authenticator {
+	return &refreshingBearerToken{fetch: fetch}
+}
+
+func (t *refreshingBearerToken) current(ctx context.Context) (string, error) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	if len(t.token) > 0 && (t.expiry.IsZero() || time.Now().Add(tokenExpiryMargin).Before(t.expiry)) {
+		return t.token, nil
+	}
+	token, expiry, err := t.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(token) == 0 {
+		return "", errors.New("token source supplied an empty bearer token")
+	}
+	t.token, t.expiry = token, expiry
+	return token, nil
+}
+
+func (t *refreshingBearerToken) Authenticate(req *http.Request) error {
+	token, err := t.current(req.Context())
+	if err != nil {
+		log.Errorf("Failed to acquire bearer token for Eureka request, error: %s", err.Error())
+		return err
+	}
+	setBearerToken(req, token)
+	return nil
+}
+
+// authenticate removes any credentials embedded in the request's URL, so that they never appear in
+// log lines or error messages, and then applies the connection's Authenticator. If the connection
+// lacks an Authenticator, it applies the embedded credentials, if any, using basic authentication.
+func (e *EurekaConnection) authenticate(req *http.Request) error {
+	userinfo := req.URL.User
+	req.URL.User = nil
+	if e.Authenticator != nil {
+		return e.Authenticator.Authenticate(req)
+	}
+	if userinfo != nil {
+		password, _ := userinfo.Password()
+		req.SetBasicAuth(userinfo.Username(), password)
+	}
+	return nil
+}
+
+// redactURL returns the given URL with any embedded password masked, for inclusion in log lines.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "<malformed URL>"
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,97 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/franela/goreq"
+)
+
+// DefaultEC2MetadataURL is the base URL of the EC2 instance metadata service.
+const DefaultEC2MetadataURL = "http://169.254.169.254/latest/meta-data/"
+
+// AWSMetadataSource retrieves metadata about the AWS instance on which the process runs, by its
+// path relative to the metadata root, such as "placement/availability-zone".
+type AWSMetadataSource interface {
+	Get(path string) (string, error)
+}
+
+// AWSMetadataFunc adapts an ordinary function to the AWSMetadataSource interface.
+type AWSMetadataFunc func(path string) (string, error)
+
+// Get calls f(path).
+func (f AWSMetadataFunc) Get(path string) (string, error) {
+	return f(path)
+}
+
+// EC2MetadataSource is an AWSMetadataSource that queries the EC2 instance metadata service.
+type EC2MetadataSource struct {
+	// URL is the base URL of the metadata service. If empty, DefaultEC2MetadataURL is used.
+	URL string
+	// Timeout bounds each request to the metadata service. If zero, five seconds is used.
+	Timeout time.Duration
+}
+
+// Get retrieves the metadata value at the given path.
+func (s EC2MetadataSource) Get(path string) (string, error) {
+	base := s.URL
+	if base == "" {
+		base = DefaultEC2MetadataURL
+	}
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	response, err := goreq.Request{Uri: strings.TrimSuffix(base, "/") + "/" + path, Timeout: timeout}.Do()
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		body, _ := response.Body.ToString()
+		return "", fmt.Errorf("bad response code: code %d does not indicate successful request, body=%s",
+			response.StatusCode,
+			body,
+		)
+	}
+	return response.Body.ToString()
+}
+
+// fetchAmazonMetadata retrieves the details of the AWS instance on which the process runs. It
+// fails only if the instance's ID or availability zone are unavailable, as the other details may
+// legitimately be absent, such as the public address of an instance in a private subnet.
+func fetchAmazonMetadata(src AWSMetadataSource) (AmazonMetadataType, error) {
+	var md AmazonMetadataType
+	fields := []struct {
+		path     string
+		dst      *string
+		required bool
+	}{
+		{"instance-id", &md.InstanceID, true},
+		{"placement/availability-zone", &md.AvailabilityZone, true},
+		{"ami-id", &md.AmiID, false},
+		{"ami-launch-index", &md.AmiLaunchIndex, false},
+		{"ami-manifest-path", &md.AmiManifestPath, false},
+		{"instance-type", &md.InstanceType, false},
+		{"hostname", &md.HostName, false},
+		{"local-hostname", &md.LocalHostname, false},
+		{"local-ipv4", &md.LocalIpv4, false},
+		{"public-hostname", &md.PublicHostname, false},
+		{"public-ipv4", &md.PublicIpv4, false},
+	}
+	for _, f := range fields {
+		v, err := src.Get(f.path)
+		if err != nil {
+			if f.required {
+				return md, fmt.Errorf("failed to retrieve AWS metadata %q: %v", f.path, err)
+			}
+			log.Debugf("AWS metadata %q is unavailable, error: %s", f.path, err.Error())
+			continue
+		}
+		*f.dst = strings.TrimSpace(v)
+	}
+	return md, nil
+}
@@ -0,0 +1,354 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults for ejecting instances from a Balancer, used when BalancerOptions.EjectAfter or
+// EjectFor is zero.
+const (
+	DefaultEjectAfter = 5
+	DefaultEjectFor   = 30 * time.Second
+)
+
+// A Candidate is an instance from which a BalancingStrategy may choose, along with the number of
+// calls the Balancer has in flight to it.
+type Candidate struct {
+	Instance *Instance
+	InFlight int
+}
+
+// A BalancingStrategy chooses which of a Balancer's instances should serve the next call.
+//
+// Choose returns the index of the chosen candidate. A Balancer calls Choose only with at least
+// one candidate, and while holding its lock, so its calls never overlap and Choose mustn't call
+// back into the Balancer. Several Balancers sharing a strategy, as a Transport's do, may call it
+// from multiple goroutines at once.
+type BalancingStrategy interface {
+	Choose(candidates []Candidate) int
+}
+
+// The BalancingStrategyFunc type is an adapter to allow the use of ordinary functions as balancing
+// strategies.
+type BalancingStrategyFunc func(candidates []Candidate) int
+
+// Choose calls f(candidates).
+func (f BalancingStrategyFunc) Choose(candidates []Candidate) int {
+	return f(candidates)
+}
+
+// RoundRobin returns a BalancingStrategy that cycles through the candidates in the order that
+// the Balancer's InstanceSetSource offers them.
+func RoundRobin() BalancingStrategy {
+	var next uint64
+	return BalancingStrategyFunc(func(candidates []Candidate) int {
+		return int((atomic.AddUint64(&next, 1) - 1) % uint64(len(candidates)))
+	})
+}
+
+// Random returns a BalancingStrategy that chooses uniformly at random among the candidates, using
+// the default shared rand.Source.
+func Random() BalancingStrategy {
+	return BalancingStrategyFunc(func(candidates []Candidate) int {
+		return rand.Intn(len(candidates))
+	})
+}
+
+// LeastOutstanding returns a BalancingStrategy that chooses the candidate with the fewest calls in
+// flight, choosing at random among those tied for the fewest.
+func LeastOutstanding() BalancingStrategy {
+	return BalancingStrategyFunc(func(candidates []Candidate) int {
+		chosen, ties := 0, 0
+		for i, c := range candidates {
+			switch {
+			case c.InFlight < candidates[chosen].InFlight:
+				chosen, ties = i, 1
+			case c.InFlight == candidates[chosen].InFlight:
+				// Reservoir sampling keeps each of the tied candidates equally likely.
+				ties++
+				if rand.Intn(ties) == 0 {
+					chosen = i
+				}
+			}
+		}
+		return chosen
+	})
+}
+
+// WeightedByMetadata returns a BalancingStrategy that chooses at random among the candidates in
+// proportion to the weight each declares as a number in its metadata under the given key. It
+// assumes the given default weight for candidates that lack the key or whose value isn't a
+// number. Candidates with a weight of zero or less are never chosen, unless all of them are, in
+// which case it chooses uniformly at random.
+//
+// A Balancer using the strategy reads each instance's weight from its metadata only once for each
+// set of instances that its InstanceSetSource offers, even when sharing the strategy with other
+// Balancers.
+func WeightedByMetadata(key string, defaultWeight float64) BalancingStrategy {
+	return weightedByMetadata{key: key, defaultWeight: defaultWeight}
+}
+
+// A weigher is a BalancingStrategy that chooses by a weight derived from each instance alone, which
+// a Balancer computes once for each set of instances its source offers.
+type weigher interface {
+	weigh(ins *Instance) float64
+	chooseWeighted(weights []float64) int
+}
+
+type weightedByMetadata struct {
+	key           string
+	defaultWeight float64
+}
+
+func (s weightedByMetadata) Choose(candidates []Candidate) int {
+	weights := make([]float64, len(candidates))
+	for i, c := range candidates {
+		weights[i] = s.weigh(c.Instance)
+	}
+	return s.chooseWeighted(weights)
+}
+
+// weigh reads the instance's weight from its metadata.
+func (s weightedByMetadata) weigh(ins *Instance) float64 {
+	switch v := metadataOf(ins)[s.key].(type) {
+	case float64:
+		return v
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return s.defaultWeight
+}
+
+func (s weightedByMetadata) chooseWeighted(weights []float64) int {
+	var total float64
+	for _, w := range weights {
+		if w > 0 {
+			total += w
+		}
+	}
+	if total <= 0 {
+		return rand.Intn(len(weights))
+	}
+	r := rand.Float64() * total
+	for i, w := range weights {
+		if w <= 0 {
+			continue
+		}
+		if r < w {
+			return i
+		}
+		r -= w
+	}
+	// Guard against rounding error leaving r just shy of exhausted.
+	for i := len(weights) - 1; ; i-- {
+		if weights[i] > 0 {
+			return i
+		}
+	}
+}
+
+// BalancerOptions adjusts how a Balancer chooses instances. The zero value selects the defaults.
+type BalancerOptions struct {
+	// Strategy chooses among the instances not ejected. It defaults to RoundRobin.
+	Strategy BalancingStrategy
+	// EjectAfter is how many consecutive errors reported for an instance cause the Balancer to
+	// eject it. It defaults to DefaultEjectAfter. A negative value disables ejection.
+	EjectAfter int
+	// EjectFor is how long an ejected instance remains ejected. It defaults to DefaultEjectFor.
+	EjectFor time.Duration
+}
+
+type balancedInstance struct {
+	inFlight     int
+	failures     int
+	ejectedUntil time.Time
+}
+
+// A Balancer spreads calls across the instances offered by an InstanceSetSource, tracking the
+// calls in flight to each instance and temporarily ejecting instances for which callers report
+// consecutive errors.
+//
+// Each call to Pick must be matched by a call to Done once the call to the picked instance
+// completes.
+type Balancer struct {
+	source     *InstanceSetSource
+	strategy   BalancingStrategy
+	ejectAfter int
+	ejectFor   time.Duration
+	m          sync.Mutex
+	instances  map[string]*balancedInstance
+	now        func() time.Time
+	// weights caches the weight of each instance in weighedFor, the latest set of instances from
+	// the source when last weighed, for a strategy that is a weigher.
+	weights    map[*Instance]float64
+	weighedFor []*Instance
+}
+
+// NewBalancer returns a Balancer choosing among the latest instances offered by the given source.
+func NewBalancer(source *InstanceSetSource, opts BalancerOptions) *Balancer {
+	b := &Balancer{
+		source:     source,
+		strategy:   opts.Strategy,
+		ejectAfter: opts.EjectAfter,
+		ejectFor:   opts.EjectFor,
+		instances:  make(map[string]*balancedInstance),
+		now:        time.Now,
+	}
+	if b.strategy == nil {
+		b.strategy = RoundRobin()
+	}
+	if b.ejectAfter == 0 {
+		b.ejectAfter = DefaultEjectAfter
+	}
+	if b.ejectFor <= 0 {
+		b.ejectFor = DefaultEjectFor
+	}
+	return b
+}
+
+// Pick chooses an instance to serve a call, counting the call as in flight until a matching call
+// to Done. It returns ErrNoInstancesAvailable if the source offers no instances.
+//
+// Pick prefers instances that aren't ejected, but if every instance is ejected, it chooses among
+// all of them rather than failing.
+func (b *Balancer) Pick() (*Instance, error) {
+	return b.pick(nil)
+}
+
+// pick is like Pick, but never chooses an instance whose ID is in the given set, returning
+// ErrNoInstancesAvailable if that leaves no instances.
+func (b *Balancer) pick(exclude map[string]bool) (*Instance, error) {
+	latest := b.source.Latest()
+	b.m.Lock()
+	defer b.m.Unlock()
+	now := b.now()
+	var candidates, ejected []Candidate
+	for _, ins := range latest {
+		id := ins.Id()
+		if exclude[id] {
+			continue
+		}
+		c := Candidate{Instance: ins}
+		s := b.instances[id]
+		if s != nil {
+			c.InFlight = s.inFlight
+		}
+		if s != nil && now.Before(s.ejectedUntil) {
+			ejected = append(ejected, c)
+		} else {
+			candidates = append(candidates, c)
+		}
+	}
+	if len(candidates) == 0 {
+		if len(ejected) == 0 {
+			return nil, ErrNoInstancesAvailable
+		}
+		log.Warningf("All %d remaining instances are ejected, choosing among them regardless", len(ejected))
+		candidates = ejected
+	}
+	b.prune(latest)
+	ins := candidates[b.choose(latest, candidates)].Instance
+	b.state(ins.Id()).inFlight++
+	return ins, nil
+}
+
+// choose asks the strategy to choose among the candidates. For a weigher, it supplies the weights
+// of the source's latest instances, weighing them anew only once the source offers a new set.
+func (b *Balancer) choose(latest []*Instance, candidates []Candidate) int {
+	w, ok := b.strategy.(weigher)
+	if !ok {
+		return b.strategy.Choose(candidates)
+	}
+	if !sameInstanceSet(latest, b.weighedFor) {
+		b.weights = make(map[*Instance]float64, len(latest))
+		for _, ins := range latest {
+			b.weights[ins] = w.weigh(ins)
+		}
+		b.weighedFor = latest
+	}
+	weights := make([]float64, len(candidates))
+	for i, c := range candidates {
+		weights[i] = b.weights[c.Instance]
+	}
+	return w.chooseWeighted(weights)
+}
+
+// sameInstanceSet reports whether the two slices are the same set of instances offered by an
+// InstanceSetSource, which offers a new slice with each update.
+func sameInstanceSet(a, b []*Instance) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// Done records the completion of a call to an instance returned by Pick, along with the call's
+// error, if any. An error counts toward ejecting the instance; success resets that count.
+func (b *Balancer) Done(ins *Instance, err error) {
+	id := ins.Id()
+	b.m.Lock()
+	defer b.m.Unlock()
+	s := b.state(id)
+	if s.inFlight > 0 {
+		s.inFlight--
+	}
+	if err == nil {
+		s.failures = 0
+		return
+	}
+	s.failures++
+	if b.ejectAfter > 0 && s.failures >= b.ejectAfter {
+		log.Warningf("Ejecting instance %s for %s after %d consecutive errors, most recently: %s", id, b.ejectFor, s.failures, err)
+		s.failures = 0
+		s.ejectedUntil = b.now().Add(b.ejectFor)
+	}
+}
+
+// InFlight returns the number of calls picked for the instance with the given ID that have yet
+// to be reported as done.
+func (b *Balancer) InFlight(id string) int {
+	b.m.Lock()
+	defer b.m.Unlock()
+	if s, ok := b.instances[id]; ok {
+		return s.inFlight
+	}
+	return 0
+}
+
+// IsEjected reports whether the instance with the given ID is currently ejected.
+func (b *Balancer) IsEjected(id string) bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+	s, ok := b.instances[id]
+	return ok && b.now().Before(s.ejectedUntil)
+}
+
+func (b *Balancer) state(id string) *balancedInstance {
+	s, ok := b.instances[id]
+	if !ok {
+		s = &balancedInstance{}
+		b.instances[id] = s
+	}
+	return s
+}
+
+// prune forgets instances that the source no longer offers, once they have no calls in flight.
+func (b *Balancer) prune(latest []*Instance) {
+	if len(b.instances) == 0 {
+		return
+	}
+	current := make(map[string]struct{}, len(latest))
+	for _, ins := range latest {
+		current[ins.Id()] = struct{}{}
+	}
+	for id, s := range b.instances {
+		if _, ok := current[id]; !ok && s.inFlight == 0 {
+			delete(b.instances, id)
+		}
+	}
+}
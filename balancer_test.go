@@ -0,0 +1,173 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func balancedInstances(ids ...string) []*Instance {
+	instances := make([]*Instance, len(ids))
+	for i, id := range ids {
+		instances[i] = &Instance{InstanceId: id, HostName: id}
+	}
+	return instances
+}
+
+func TestBalancer(t *testing.T) {
+	Convey("Given a balancer over three instances", t, func() {
+		source := &InstanceSetSource{instances: balancedInstances("a", "b", "c")}
+		now := time.Now()
+		opts := BalancerOptions{EjectAfter: 2, EjectFor: time.Minute}
+
+		pick := func(b *Balancer) string {
+			ins, err := b.Pick()
+			So(err, ShouldBeNil)
+			return ins.Id()
+		}
+
+		Convey("round robin cycles through the instances", func() {
+			b := NewBalancer(source, opts)
+			var picked []string
+			for i := 0; i < 4; i++ {
+				picked = append(picked, pick(b))
+			}
+			So(picked, ShouldResemble, []string{"a", "b", "c", "a"})
+		})
+
+		Convey("in-flight calls are counted until done", func() {
+			b := NewBalancer(source, opts)
+			ins, err := b.Pick()
+			So(err, ShouldBeNil)
+			So(b.InFlight(ins.Id()), ShouldEqual, 1)
+			b.Done(ins, nil)
+			So(b.InFlight(ins.Id()), ShouldEqual, 0)
+		})
+
+		Convey("least outstanding prefers idle instances", func() {
+			opts.Strategy = LeastOutstanding()
+			b := NewBalancer(source, opts)
+			seen := map[string]bool{}
+			for i := 0; i < 3; i++ {
+				seen[pick(b)] = true
+			}
+			So(seen, ShouldHaveLength, 3)
+
+			Convey("and those that finish first", func() {
+				b.Done(source.instances[1], nil)
+				So(pick(b), ShouldEqual, "b")
+			})
+		})
+
+		Convey("random chooses among all instances", func() {
+			opts.Strategy = Random()
+			b := NewBalancer(source, opts)
+			seen := map[string]bool{}
+			for i := 0; i < 200; i++ {
+				seen[pick(b)] = true
+			}
+			So(seen, ShouldHaveLength, 3)
+		})
+
+		Convey("weighting by metadata follows the declared weights", func() {
+			source.instances[0].Metadata.Raw = []byte("<weight>0</weight>")
+			source.instances[1].Metadata.Raw = []byte("<weight>3</weight>")
+			source.instances[2].Metadata.Raw = []byte("<weight>bogus</weight>")
+			opts.Strategy = WeightedByMetadata("weight", 1)
+			b := NewBalancer(source, opts)
+			counts := map[string]int{}
+			for i := 0; i < 400; i++ {
+				counts[pick(b)]++
+			}
+			So(counts["a"], ShouldEqual, 0)
+			So(counts["b"], ShouldBeGreaterThan, counts["c"])
+			So(counts["c"], ShouldBeGreaterThan, 0)
+
+			Convey("reading each weight only once per source update", func() {
+				source.instances[0].Metadata.Raw = []byte("<weight>1000</weight>")
+				for i := 0; i < 100; i++ {
+					So(pick(b), ShouldNotEqual, "a")
+				}
+
+				updated := balancedInstances("a", "b", "c")
+				updated[0].Metadata.Raw = []byte("<weight>1</weight>")
+				updated[1].Metadata.Raw = []byte("<weight>0</weight>")
+				updated[2].Metadata.Raw = []byte("<weight>0</weight>")
+				source.instances = updated
+				for i := 0; i < 10; i++ {
+					So(pick(b), ShouldEqual, "a")
+				}
+			})
+
+			Convey("even when other balancers share the strategy", func() {
+				for i := 0; i < 3; i++ {
+					other := &InstanceSetSource{instances: balancedInstances("x", "y")}
+					So(pick(NewBalancer(other, opts)), ShouldBeIn, "x", "y")
+				}
+				source.instances[0].Metadata.Raw = []byte("<weight>1000</weight>")
+				for i := 0; i < 100; i++ {
+					So(pick(b), ShouldNotEqual, "a")
+				}
+			})
+		})
+
+		Convey("consecutive errors eject an instance", func() {
+			b := NewBalancer(source, opts)
+			b.now = func() time.Time { return now }
+			a := source.instances[0]
+			failure := errors.New("connection refused")
+			b.Done(a, failure)
+			So(b.IsEjected("a"), ShouldBeFalse)
+
+			Convey("unless a success intervenes", func() {
+				b.Done(a, nil)
+				b.Done(a, failure)
+				So(b.IsEjected("a"), ShouldBeFalse)
+			})
+
+			Convey("so that it isn't picked", func() {
+				b.Done(a, failure)
+				So(b.IsEjected("a"), ShouldBeTrue)
+				for i := 0; i < 4; i++ {
+					So(pick(b), ShouldNotEqual, "a")
+				}
+
+				Convey("until the ejection lapses", func() {
+					now = now.Add(time.Minute)
+					So(b.IsEjected("a"), ShouldBeFalse)
+					seen := map[string]bool{}
+					for i := 0; i < 3; i++ {
+						seen[pick(b)] = true
+					}
+					So(seen, ShouldContainKey, "a")
+				})
+			})
+
+			Convey("though all ejected instances remain available as a last resort", func() {
+				for _, ins := range source.instances {
+					b.Done(ins, failure)
+					b.Done(ins, failure)
+				}
+				So(pick(b), ShouldBeIn, []string{"a", "b", "c"})
+			})
+		})
+
+		Convey("instances no longer offered are forgotten", func() {
+			b := NewBalancer(source, opts)
+			b.Done(source.instances[2], errors.New("timeout"))
+			source.instances = source.instances[:2]
+			pick(b)
+			So(b.instances, ShouldNotContainKey, "c")
+		})
+
+		Convey("no instances to choose from is an error", func() {
+			b := NewBalancer(&InstanceSetSource{}, opts)
+			_, err := b.Pick()
+			So(err, ShouldEqual, ErrNoInstancesAvailable)
+		})
+	})
+}
@@ -0,0 +1,224 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// baseURLTemplate yields the root URL of an instance, preferring its insecure port.
+const baseURLTemplate = `{{if .PortEnabled}}http://{{.HostName}}:{{.Port}}{{else}}https://{{.HostName}}:{{.SecurePort}}{{end}}`
+
+// Templates from which an InstanceBuilder derives an instance's URLs by default, matching the
+// paths Eureka assumes.
+const (
+	DefaultHomePageURLTemplate    = baseURLTemplate + "/"
+	DefaultStatusPageURLTemplate  = baseURLTemplate + "/info"
+	DefaultHealthCheckURLTemplate = baseURLTemplate + "/healthcheck"
+)
+
+// DefaultLeaseDuration is how long Eureka retains an instance without a heartbeat by default.
+const DefaultLeaseDuration = 90 * time.Second
+
+// InstanceBuilder constructs an Instance describing the process in which it runs, detecting what
+// it can about the host and filling in Eureka's defaults for the rest.
+type InstanceBuilder struct {
+	// App names the application to which the instance belongs. It is required.
+	App string
+	// VipAddress and SecureVipAddress name the virtual addresses by which clients find the
+	// instance. If both are empty, the VIP address is the application name in lower case.
+	VipAddress       string
+	SecureVipAddress string
+	// HostName and IPAddr override the host name and address detected for the instance.
+	HostName string
+	IPAddr   string
+	// Port and SecurePort, if positive, enable the corresponding ports. An instance may have
+	// neither, as a worker serving no requests might.
+	Port       int
+	SecurePort int
+	// Status is the initial status of the instance. If empty, UP is used.
+	Status StatusType
+	// DataCenter names the type of data center hosting the instance: Amazon or MyOwn. If empty,
+	// the builder uses Amazon if it can retrieve metadata from AWSMetadata, and MyOwn otherwise.
+	DataCenter string
+	// AWSMetadata retrieves the details of the AWS instance hosting the process. If nil, an
+	// EC2MetadataSource is used when DataCenter is Amazon, and no AWS metadata is sought otherwise.
+	AWSMetadata AWSMetadataSource
+	// HomePageURLTemplate, StatusPageURLTemplate, and HealthCheckURLTemplate are text/template
+	// templates from which the instance's URLs are derived, executed with the otherwise complete
+	// Instance as their data. If empty, the corresponding default template is used, unless the
+	// instance has no port, in which case the URL is left empty.
+	HomePageURLTemplate    string
+	StatusPageURLTemplate  string
+	HealthCheckURLTemplate string
+	// LeaseRenewalInterval and LeaseDuration populate the instance's LeaseInfo. If zero,
+	// DefaultRenewalInterval and DefaultLeaseDuration are used, respectively.
+	LeaseRenewalInterval time.Duration
+	LeaseDuration        time.Duration
+	// Metadata populates the instance's metadata.
+	Metadata map[string]string
+}
+
+// Build constructs the instance, returning an error if it can't detect the instance's details or
+// the resulting instance wouldn't be accepted by Eureka, as reported by Instance.Validate.
+func (b *InstanceBuilder) Build() (*Instance, error) {
+	ins := &Instance{
+		App:               b.App,
+		VipAddress:        b.VipAddress,
+		SecureVipAddress:  b.SecureVipAddress,
+		HostName:          b.HostName,
+		IPAddr:            b.IPAddr,
+		Status:            b.Status,
+		Port:              b.Port,
+		PortEnabled:       b.Port > 0,
+		SecurePort:        b.SecurePort,
+		SecurePortEnabled: b.SecurePort > 0,
+		LeaseInfo: LeaseInfo{
+			RenewalIntervalInSecs: durationInSecs(b.LeaseRenewalInterval, DefaultRenewalInterval),
+			DurationInSecs:        durationInSecs(b.LeaseDuration, DefaultLeaseDuration),
+		},
+	}
+	if len(ins.Status) == 0 {
+		ins.Status = UP
+	}
+	if ins.VipAddress == "" && ins.SecureVipAddress == "" {
+		ins.VipAddress = strings.ToLower(ins.App)
+	}
+	if err := b.populateDataCenterInfo(ins); err != nil {
+		return nil, err
+	}
+	if ins.HostName == "" {
+		hostName, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to detect host name: %v", err)
+		}
+		ins.HostName = hostName
+	}
+	if ins.IPAddr == "" {
+		addrs, err := net.InterfaceAddrs()
+		if err != nil {
+			return nil, fmt.Errorf("failed to detect IP address: %v", err)
+		}
+		if ins.IPAddr, err = selectHostAddress(addrs); err != nil {
+			return nil, err
+		}
+	}
+	for _, u := range []struct {
+		dst      *string
+		tmpl     string
+		fallback string
+	}{
+		{&ins.HomePageUrl, b.HomePageURLTemplate, DefaultHomePageURLTemplate},
+		{&ins.StatusPageUrl, b.StatusPageURLTemplate, DefaultStatusPageURLTemplate},
+		{&ins.HealthCheckUrl, b.HealthCheckURLTemplate, DefaultHealthCheckURLTemplate},
+	} {
+		if u.tmpl == "" {
+			if !ins.PortEnabled && !ins.SecurePortEnabled {
+				continue
+			}
+			u.tmpl = u.fallback
+		}
+		s, err := executeURLTemplate(u.tmpl, ins)
+		if err != nil {
+			return nil, err
+		}
+		*u.dst = s
+	}
+	for k, v := range b.Metadata {
+		if err := ins.Metadata.update(map[string]string{k: v}, nil); err != nil {
+			return nil, err
+		}
+	}
+	if err := ins.Validate(); err != nil {
+		return nil, err
+	}
+	return ins, nil
+}
+
+func (b *InstanceBuilder) populateDataCenterInfo(ins *Instance) error {
+	src := b.AWSMetadata
+	switch b.DataCenter {
+	case MyOwn:
+		ins.DataCenterInfo.Name = MyOwn
+		return nil
+	case Amazon:
+		if src == nil {
+			src = EC2MetadataSource{}
+		}
+	case "":
+		if src == nil {
+			ins.DataCenterInfo.Name = MyOwn
+			return nil
+		}
+	default:
+		return fmt.Errorf("unsupported data center %q", b.DataCenter)
+	}
+	md, err := fetchAmazonMetadata(src)
+	if err != nil {
+		if b.DataCenter == Amazon {
+			return err
+		}
+		log.Noticef("Not running in AWS, using data center %s, error: %s", MyOwn, err.Error())
+		ins.DataCenterInfo.Name = MyOwn
+		return nil
+	}
+	ins.DataCenterInfo = DataCenterInfo{Name: Amazon, Metadata: md}
+	if ins.HostName == "" {
+		ins.HostName = md.PublicHostname
+		if ins.HostName == "" {
+			ins.HostName = md.LocalHostname
+		}
+	}
+	if ins.IPAddr == "" {
+		ins.IPAddr = md.LocalIpv4
+	}
+	return nil
+}
+
+func durationInSecs(d, fallback time.Duration) int32 {
+	if d <= 0 {
+		d = fallback
+	}
+	return int32(d / time.Second)
+}
+
+// selectHostAddress chooses the address by which other hosts most likely reach this one: the
+// first global unicast IPv4 address, or failing that, the first global unicast IPv6 address.
+func selectHostAddress(addrs []net.Addr) (string, error) {
+	var v6 net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || !ipNet.IP.IsGlobalUnicast() {
+			continue
+		}
+		if ip := ipNet.IP.To4(); ip != nil {
+			return ip.String(), nil
+		}
+		if v6 == nil {
+			v6 = ipNet.IP
+		}
+	}
+	if v6 != nil {
+		return v6.String(), nil
+	}
+	return "", errors.New("failed to detect IP address: no non-loopback address found")
+}
+
+func executeURLTemplate(text string, ins *Instance) (string, error) {
+	tmpl, err := template.New("url").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL template %q: %v", text, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, ins); err != nil {
+		return "", fmt.Errorf("failed to execute URL template %q: %v", text, err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,205 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestInstanceBuilder(t *testing.T) {
+	awsMetadata := map[string]string{
+		"instance-id":                 "i-0abc123",
+		"placement/availability-zone": "us-east-1c",
+		"local-hostname":              "ip-10-0-0-5.ec2.internal",
+		"local-ipv4":                  "10.0.0.5",
+		"instance-type":               "m5.large",
+	}
+	aws := AWSMetadataFunc(func(path string) (string, error) {
+		if v, ok := awsMetadata[path]; ok {
+			return v, nil
+		}
+		return "", errors.New("not found")
+	})
+	notAWS := AWSMetadataFunc(func(path string) (string, error) {
+		return "", errors.New("unreachable")
+	})
+
+	Convey("Given a builder for an instance outside AWS", t, func() {
+		b := &InstanceBuilder{
+			App:        "TESTAPP",
+			VipAddress: "testapp",
+			HostName:   "host.example.com",
+			IPAddr:     "192.0.2.10",
+			Port:       8080,
+			Metadata:   map[string]string{"version": "1.2.3"},
+		}
+
+		Convey("it fills in the defaults", func() {
+			ins, err := b.Build()
+			So(err, ShouldBeNil)
+			So(ins.Status, ShouldEqual, UP)
+			So(ins.PortEnabled, ShouldBeTrue)
+			So(ins.SecurePortEnabled, ShouldBeFalse)
+			So(ins.DataCenterInfo.Name, ShouldEqual, MyOwn)
+			So(ins.HomePageUrl, ShouldEqual, "http://host.example.com:8080/")
+			So(ins.StatusPageUrl, ShouldEqual, "http://host.example.com:8080/info")
+			So(ins.HealthCheckUrl, ShouldEqual, "http://host.example.com:8080/healthcheck")
+			So(ins.LeaseInfo.RenewalIntervalInSecs, ShouldEqual, 30)
+			So(ins.LeaseInfo.DurationInSecs, ShouldEqual, 90)
+			v, err := ins.Metadata.GetString("version")
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, "1.2.3")
+		})
+
+		Convey("its URLs follow the given templates", func() {
+			b.SecurePort = 8443
+			b.HealthCheckURLTemplate = "https://{{.IPAddr}}:{{.SecurePort}}/health"
+			ins, err := b.Build()
+			So(err, ShouldBeNil)
+			So(ins.HealthCheckUrl, ShouldEqual, "https://192.0.2.10:8443/health")
+			So(ins.HomePageUrl, ShouldEqual, "http://host.example.com:8080/")
+		})
+
+		Convey("its default URLs use the secure port when it is the only one", func() {
+			b.Port = 0
+			b.SecurePort = 8443
+			ins, err := b.Build()
+			So(err, ShouldBeNil)
+			So(ins.HomePageUrl, ShouldEqual, "https://host.example.com:8443/")
+		})
+
+		Convey("it detects the host when not told", func() {
+			b.HostName = ""
+			b.IPAddr = ""
+			ins, err := b.Build()
+			if err != nil {
+				// Some sandboxes have only a loopback interface.
+				So(err.Error(), ShouldContainSubstring, "IP address")
+				return
+			}
+			So(ins.HostName, ShouldNotBeEmpty)
+			So(net.ParseIP(ins.IPAddr), ShouldNotBeNil)
+		})
+
+		Convey("it falls back to MyOwn when AWS metadata is unavailable", func() {
+			b.AWSMetadata = notAWS
+			ins, err := b.Build()
+			So(err, ShouldBeNil)
+			So(ins.DataCenterInfo.Name, ShouldEqual, MyOwn)
+		})
+
+		Convey("it fails if AWS is required but unavailable", func() {
+			b.DataCenter = Amazon
+			b.AWSMetadata = notAWS
+			_, err := b.Build()
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("it accepts an instance without a port, leaving its URLs empty", func() {
+			b.Port = 0
+			ins, err := b.Build()
+			So(err, ShouldBeNil)
+			So(ins.PortEnabled, ShouldBeFalse)
+			So(ins.HomePageUrl, ShouldBeEmpty)
+			So(ins.HealthCheckUrl, ShouldBeEmpty)
+		})
+
+		Convey("it rejects an instance without an application", func() {
+			b.App = ""
+			_, err := b.Build()
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("it rejects an invalid URL template", func() {
+			b.StatusPageURLTemplate = "http://{{.NoSuchField}}/"
+			_, err := b.Build()
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given a builder for an instance in AWS", t, func() {
+		b := &InstanceBuilder{App: "TESTAPP", Port: 8080, AWSMetadata: aws}
+
+		Convey("it describes the AWS instance", func() {
+			ins, err := b.Build()
+			So(err, ShouldBeNil)
+			So(ins.DataCenterInfo.Name, ShouldEqual, Amazon)
+			So(ins.DataCenterInfo.Metadata.InstanceID, ShouldEqual, "i-0abc123")
+			So(ins.DataCenterInfo.Metadata.AvailabilityZone, ShouldEqual, "us-east-1c")
+			So(ins.DataCenterInfo.Metadata.InstanceType, ShouldEqual, "m5.large")
+			So(ins.DataCenterInfo.Metadata.PublicIpv4, ShouldBeEmpty)
+			So(ins.HostName, ShouldEqual, "ip-10-0-0-5.ec2.internal")
+			So(ins.IPAddr, ShouldEqual, "10.0.0.5")
+			So(ins.Id(), ShouldEqual, "i-0abc123")
+		})
+	})
+}
+
+func TestSelectHostAddress(t *testing.T) {
+	cidr := func(s string) net.Addr {
+		ip, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ipNet.IP = ip
+		return ipNet
+	}
+
+	Convey("Selecting a host address", t, func() {
+		Convey("skips loopback and link-local addresses, preferring IPv4", func() {
+			addr, err := selectHostAddress([]net.Addr{
+				cidr("127.0.0.1/8"),
+				cidr("::1/128"),
+				cidr("fe80::1/64"),
+				cidr("2001:db8::5/64"),
+				cidr("10.1.2.3/24"),
+			})
+			So(err, ShouldBeNil)
+			So(addr, ShouldEqual, "10.1.2.3")
+		})
+
+		Convey("uses IPv6 when no IPv4 address is available", func() {
+			addr, err := selectHostAddress([]net.Addr{cidr("127.0.0.1/8"), cidr("2001:db8::5/64")})
+			So(err, ShouldBeNil)
+			So(addr, ShouldEqual, "2001:db8::5")
+		})
+
+		Convey("fails with only loopback addresses", func() {
+			_, err := selectHostAddress([]net.Addr{cidr("127.0.0.1/8")})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestEC2MetadataSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/latest/meta-data/placement/availability-zone" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("us-west-2b"))
+	}))
+	defer server.Close()
+	src := EC2MetadataSource{URL: server.URL + "/latest/meta-data/"}
+
+	Convey("An EC2 metadata source", t, func() {
+		Convey("retrieves metadata by path", func() {
+			zone, err := src.Get("placement/availability-zone")
+			So(err, ShouldBeNil)
+			So(zone, ShouldEqual, "us-west-2b")
+		})
+
+		Convey("fails for missing metadata", func() {
+			_, err := src.Get("public-ipv4")
+			So(err, ShouldNotBeNil)
+			So(strings.Contains(err.Error(), "404"), ShouldBeTrue)
+		})
+	})
+}
@@ -36,10 +36,19 @@ type eureka struct {
 	ServerPort            int      // default 7001
 	ServerURLBase         string   // default "eureka/v2"
 	PollIntervalSeconds   int      // default 30
-	EnableDelta           bool     // TODO: Support querying for deltas
+	EnableDelta           bool     // default false
 	PreferSameZone        bool     // default false
 	RegisterWithEureka    bool     // default false
 	Retries               int      // default 3
+	QuarantineSeconds     int      // default 30
+	MaxQuarantineSeconds  int      // default 300
+	TLSCAFile             string   // default "", trusting the host's root CAs
+	TLSCertFile           string   // default "", presenting no client certificate
+	TLSKeyFile            string   // default ""
+	TLSInsecureSkipVerify bool     // default false
+	TLSServerName         string   // default "", using the service URL's host name
+	SnapshotDir           string   // default "", persisting no snapshots
+	RetainStaleSeconds    int      // default 0, discarding data once an update fails
 }
 
 // ReadConfig from a file location. Minimal error handling. Just bails and passes up
@@ -68,6 +77,12 @@ func (c *Config) fillDefaults() {
 	if c.Eureka.PollIntervalSeconds == 0 {
 		c.Eureka.PollIntervalSeconds = 30
 	}
+	if c.Eureka.QuarantineSeconds == 0 {
+		c.Eureka.QuarantineSeconds = 30
+	}
+	if c.Eureka.MaxQuarantineSeconds == 0 {
+		c.Eureka.MaxQuarantineSeconds = 300
+	}
 	if len(c.Eureka.ServerURLBase) == 0 {
 		c.Eureka.ServerURLBase = "eureka/v2"
 	}
@@ -13,16 +13,30 @@ func init() {
 }
 
 // SelectServiceURL gets a eureka instance based on the connection's load
-// balancing scheme.
-// TODO: Make this not just pick a random one.
-func (e *EurekaConnection) SelectServiceURL() string {
+// balancing scheme. It prefers healthy servers over those quarantined after
+// recent failures, and, if PreferSameZone is set, servers in the connection's
+// local zone over those in other zones, choosing randomly among equals.
+//
+// It returns ErrNoServiceURLs if the connection has no service URLs from which to
+// choose.
+func (e *EurekaConnection) SelectServiceURL() (string, error) {
+	candidates, err := e.serviceURLCandidates()
+	if err != nil {
+		return "", err
+	}
+	return candidates[0], nil
+}
+
+// serviceURLs returns the connection's current set of service URLs, refreshing them first from DNS
+// if the connection uses DNS discovery and the last discovered set has expired.
+func (e *EurekaConnection) serviceURLs() []string {
 	if e.discoveryTtl == nil {
 		e.discoveryTtl = make(chan struct{}, 1)
 	}
 	if e.DNSDiscovery && len(e.discoveryTtl) == 0 {
-		servers, ttl, err := discoverDNS(e.DiscoveryZone, e.ServicePort, e.ServerURLBase)
+		zones, ttl, err := discoverDNSByZone(e.DiscoveryZone, e.ServicePort, e.ServerURLBase)
 		if err != nil {
-			return choice(e.ServiceUrls)
+			return e.ServiceUrls
 		}
 		e.discoveryTtl <- struct{}{}
 		time.AfterFunc(ttl, func() {
@@ -30,16 +44,25 @@ func (e *EurekaConnection) SelectServiceURL() string {
 			// SelectServiceURL call will refresh the DNS info
 			<-e.discoveryTtl
 		})
+		var servers []string
+		for _, zoneServers := range zones {
+			servers = append(servers, zoneServers...)
+		}
 		e.ServiceUrls = servers
+		e.ZoneServiceUrls = zones
 	}
-	return choice(e.ServiceUrls)
+	return e.ServiceUrls
 }
 
-func choice(options []string) string {
-	if len(options) == 0 {
-		log.Fatal("There are no ServiceUrls to choose from, bailing out")
+// serviceURLCandidates returns the connection's service URLs in the order in which a request
+// should try them, preferring healthy servers over those quarantined after recent failures.
+func (e *EurekaConnection) serviceURLCandidates() ([]string, error) {
+	urls := e.serviceURLs()
+	if len(urls) == 0 {
+		log.Error("There are no ServiceUrls to choose from")
+		return nil, ErrNoServiceURLs
 	}
-	return options[rand.Int()%len(options)]
+	return e.orderServiceURLs(urls), nil
 }
 
 // NewConnFromConfigFile sets up a connection object based on a config in
@@ -58,12 +81,29 @@ func NewConnFromConfigFile(location string) (c EurekaConnection, err error) {
 func NewConnFromConfig(conf Config) (c EurekaConnection) {
 	c.ServiceUrls = conf.Eureka.ServiceUrls
 	c.ServicePort = conf.Eureka.ServerPort
+	c.ZoneServiceUrls = zoneServiceURLsFromConfig(conf.AWS)
+	if len(c.ServiceUrls) == 0 {
+		for _, urls := range c.ZoneServiceUrls {
+			c.ServiceUrls = append(c.ServiceUrls, urls...)
+		}
+	}
 	if len(c.ServiceUrls) == 0 && len(conf.Eureka.ServerDNSName) > 0 {
 		c.ServiceUrls = []string{conf.Eureka.ServerDNSName}
 	}
-	c.Timeout = time.Duration(conf.Eureka.ConnectTimeoutSeconds) * time.Second
+	c.ConnectTimeout = time.Duration(conf.Eureka.ConnectTimeoutSeconds) * time.Second
 	c.PollInterval = time.Duration(conf.Eureka.PollIntervalSeconds) * time.Second
+	c.Retries = conf.Eureka.Retries
+	c.EnableDelta = conf.Eureka.EnableDelta
+	c.SnapshotDir = conf.Eureka.SnapshotDir
+	c.RetainStaleFor = time.Duration(conf.Eureka.RetainStaleSeconds) * time.Second
+	c.QuarantineDuration = time.Duration(conf.Eureka.QuarantineSeconds) * time.Second
+	c.MaxQuarantineDuration = time.Duration(conf.Eureka.MaxQuarantineSeconds) * time.Second
+	c.servers = newServerTracker()
 	c.PreferSameZone = conf.Eureka.PreferSameZone
+	if c.PreferSameZone {
+		c.Zone = localZoneFromConfig(conf)
+	}
+	c.TLS = tlsSettingsFromConfig(conf.Eureka)
 	if conf.Eureka.UseDNSForServiceUrls {
 		log.Warning("UseDNSForServiceUrls is an experimental option")
 		c.DNSDiscovery = true
@@ -78,6 +118,7 @@ func NewConnFromConfig(conf Config) (c EurekaConnection) {
 // and are going to do the configuration yourself some other way.
 func NewConn(address ...string) (e EurekaConnection) {
 	e.ServiceUrls = address
+	e.servers = newServerTracker()
 	return e
 }
 
@@ -151,9 +192,10 @@ func (e *EurekaConnection) ScheduleAppUpdates(name string, await bool, done <-ch
 
 // An AppSource holds a periodically updated copy of a Eureka application.
 type AppSource struct {
-	m    sync.RWMutex
-	app  *Application
-	done chan<- struct{}
+	m         sync.RWMutex
+	app       *Application
+	freshness freshness
+	done      chan<- struct{}
 }
 
 // NewAppSource returns a new AppSource that offers a periodically updated copy
@@ -164,23 +206,39 @@ type AppSource struct {
 // before returning, though it's possible that that first update attempt could
 // fail, so that a subsequent call to Latest would return nil and CopyLatestTo
 // would return false.
+//
+// If the connection has a positive RetainStaleFor, the source retains its
+// latest application despite failed update attempts until that long after its
+// last successful update. If the connection has a SnapshotDir, the source
+// starts out with the application from its last persisted snapshot, if any,
+// and retains it despite failed update attempts until an update succeeds.
 func (e *EurekaConnection) NewAppSource(name string, await bool) *AppSource {
 	done := make(chan struct{})
 	s := &AppSource{
-		done: done,
+		freshness: freshness{retainFor: e.RetainStaleFor},
+		done:      done,
 	}
-	produce := func() (*Application, error) {
-		return e.GetApp(name)
+	snapshot := e.snapshotPath("app", name)
+	if apps, ok := e.loadSnapshot(snapshot); ok && len(apps) == 1 {
+		s.app = apps[0]
+		s.freshness.seeded()
 	}
-	if await {
-		if app, err := produce(); err == nil {
-			s.app = app
+	produce := func() (*Application, error) {
+		app, err := e.GetApp(name)
+		if err == nil {
+			e.saveSnapshot(snapshot, []*Application{app})
 		}
+		return app, err
 	}
 	consume := func(app *Application, err error) {
 		s.m.Lock()
-		s.app = app
-		s.m.Unlock()
+		defer s.m.Unlock()
+		if !s.freshness.record(err) {
+			s.app = app
+		}
+	}
+	if await {
+		consume(produce())
 	}
 	go exchangeAppEvery(e.PollInterval, produce, consume, done)
 	return s
@@ -188,7 +246,8 @@ func (e *EurekaConnection) NewAppSource(name string, await bool) *AppSource {
 
 // Latest returns the most recently acquired Eureka application, if any. If the
 // most recent update attempt failed, or if no update attempt has yet to
-// complete, it returns nil.
+// complete, it returns nil, unless the source retains its previous application
+// as described for NewAppSource.
 func (s *AppSource) Latest() *Application {
 	if s == nil {
 		return nil
@@ -198,6 +257,40 @@ func (s *AppSource) Latest() *Application {
 	return s.app
 }
 
+// IsStale returns true if the source's latest application is retained despite
+// the most recent update attempt having failed, or came from a persisted
+// snapshot rather than from Eureka, with no update having yet succeeded.
+func (s *AppSource) IsStale() bool {
+	if s == nil {
+		return false
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.freshness.stale
+}
+
+// LastError returns the error from the source's most recent update attempt, or
+// nil if that attempt succeeded or no attempt has yet to complete.
+func (s *AppSource) LastError() error {
+	if s == nil {
+		return nil
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.freshness.lastErr
+}
+
+// LastSuccess returns the time at which the source last updated its
+// application successfully, or the zero time if no update has yet succeeded.
+func (s *AppSource) LastSuccess() time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.freshness.lastSuccess
+}
+
 // CopyLatestTo copies the most recently acquired Eureka application to dst, if
 // any, and returns true if such an application was available. If no preceding
 // update attempt had succeeded, such that no application is available to be
@@ -0,0 +1,168 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// appsHashcode summarizes the instances in the given applications in the format Eureka uses to
+// reconcile registry deltas: the count of instances in each status, ordered by status name, such
+// as "DOWN_2_UP_5_".
+func appsHashcode(apps map[string]*Application) string {
+	counts := make(map[StatusType]int)
+	for _, app := range apps {
+		for _, ins := range app.Instances {
+			counts[ins.Status]++
+		}
+	}
+	statuses := make([]string, 0, len(counts))
+	for status := range counts {
+		statuses = append(statuses, string(status))
+	}
+	sort.Strings(statuses)
+	var b strings.Builder
+	for _, status := range statuses {
+		b.WriteString(status)
+		b.WriteByte('_')
+		b.WriteString(strconv.Itoa(counts[StatusType(status)]))
+		b.WriteByte('_')
+	}
+	return b.String()
+}
+
+// applyDelta returns a copy of the given applications with the changes in the given delta
+// applied. It leaves the supplied applications intact, sharing with the result only those
+// applications that the delta doesn't change.
+func applyDelta(apps map[string]*Application, delta []*Application) map[string]*Application {
+	result := make(map[string]*Application, len(apps))
+	for name, app := range apps {
+		result[name] = app
+	}
+	copied := make(map[string]bool)
+	appFor := func(name string) *Application {
+		if copied[name] {
+			return result[name]
+		}
+		copied[name] = true
+		app := &Application{Name: name}
+		if prev, ok := result[name]; ok {
+			app.Instances = append([]*Instance(nil), prev.Instances...)
+		}
+		result[name] = app
+		return app
+	}
+	indexOf := func(app *Application, id string) int {
+		for i, ins := range app.Instances {
+			if ins.Id() == id {
+				return i
+			}
+		}
+		return -1
+	}
+	for _, d := range delta {
+		for _, ins := range d.Instances {
+			switch ins.ActionType {
+			case ADDED, MODIFIED:
+				app := appFor(d.Name)
+				if i := indexOf(app, ins.Id()); i >= 0 {
+					app.Instances[i] = ins
+				} else {
+					app.Instances = append(app.Instances, ins)
+				}
+			case DELETED:
+				if _, ok := result[d.Name]; !ok {
+					continue
+				}
+				app := appFor(d.Name)
+				if i := indexOf(app, ins.Id()); i >= 0 {
+					app.Instances = append(app.Instances[:i], app.Instances[i+1:]...)
+				}
+				if len(app.Instances) == 0 {
+					delete(result, d.Name)
+				}
+			default:
+				log.Warningf("Ignoring unknown action type %q for Instance=%s App=%s in registry delta", ins.ActionType, ins.Id(), d.Name)
+			}
+		}
+	}
+	return result
+}
+
+// A RegistryClient holds a copy of the full Eureka registry, keeping it current on request.
+//
+// When its connection has EnableDelta set, a RegistryClient fetches the full registry only
+// initially, and subsequently fetches only the changes made since, applying them to its copy. If
+// its copy then disagrees with the registry, as summarized by the hashcode accompanying the
+// changes, it fetches the full registry again.
+type RegistryClient struct {
+	e        *EurekaConnection
+	refresh  sync.Mutex
+	m        sync.RWMutex
+	apps     map[string]*Application
+	hashcode string
+}
+
+// NewRegistryClient returns a RegistryClient that holds no applications until its first call to
+// Refresh.
+func (e *EurekaConnection) NewRegistryClient() *RegistryClient {
+	return &RegistryClient{e: e}
+}
+
+// Refresh brings the client's copy of the registry up to date. If it fails, the client retains
+// its previous copy.
+func (c *RegistryClient) Refresh(ctx context.Context) error {
+	c.refresh.Lock()
+	defer c.refresh.Unlock()
+	apps := c.Apps()
+	if c.e.EnableDelta && apps != nil {
+		r, err := c.e.GetAppsDeltaContext(ctx)
+		if err == nil {
+			updated := applyDelta(apps, r.Applications)
+			hashcode := appsHashcode(updated)
+			if hashcode == r.AppsHashcode {
+				c.update(updated, hashcode)
+				return nil
+			}
+			log.Warningf("Registry hashcode %q after applying delta doesn't match Eureka's hashcode %q, fetching full registry", hashcode, r.AppsHashcode)
+		} else if ctx.Err() != nil {
+			return err
+		} else {
+			log.Warningf("Failed to fetch registry delta, fetching full registry, error: %s", err.Error())
+		}
+	}
+	apps, err := c.e.GetAppsContext(ctx)
+	if err != nil {
+		return err
+	}
+	c.update(apps, appsHashcode(apps))
+	return nil
+}
+
+func (c *RegistryClient) update(apps map[string]*Application, hashcode string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.apps = apps
+	c.hashcode = hashcode
+}
+
+// Apps returns the client's current copy of the registry, keyed by application name, or nil if
+// the client has yet to fetch the registry successfully. Callers must not modify the applications
+// returned.
+func (c *RegistryClient) Apps() map[string]*Application {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	return c.apps
+}
+
+// Hashcode returns the hashcode summarizing the client's current copy of the registry, in the
+// format Eureka uses to reconcile registry deltas.
+func (c *RegistryClient) Hashcode() string {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	return c.hashcode
+}
@@ -0,0 +1,155 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func instanceXML(host string, status StatusType, action ActionType) string {
+	var actionType string
+	if len(action) > 0 {
+		actionType = fmt.Sprintf("<actionType>%s</actionType>", action)
+	}
+	return fmt.Sprintf("<instance><hostName>%s</hostName><app>TESTAPP</app><status>%s</status>%s</instance>", host, status, actionType)
+}
+
+func appsXML(hashcode string, instances ...string) string {
+	return fmt.Sprintf("<applications><versions__delta>1</versions__delta><apps__hashcode>%s</apps__hashcode><application><name>TESTAPP</name>%s</application></applications>", hashcode, strings.Join(instances, ""))
+}
+
+func TestAppsHashcode(t *testing.T) {
+	Convey("The apps hashcode counts instances by status in status order", t, func() {
+		apps := map[string]*Application{
+			"A": {Name: "A", Instances: []*Instance{{Status: UP}, {Status: DOWN}}},
+			"B": {Name: "B", Instances: []*Instance{{Status: UP}, {Status: UP}, {Status: DOWN}, {Status: UP}, {Status: UP}}},
+		}
+		So(appsHashcode(apps), ShouldEqual, "DOWN_2_UP_5_")
+		So(appsHashcode(nil), ShouldEqual, "")
+	})
+}
+
+func TestApplyDelta(t *testing.T) {
+	Convey("Given a copy of the registry", t, func() {
+		a1 := &Instance{HostName: "a1", Status: UP}
+		a2 := &Instance{HostName: "a2", Status: UP}
+		b1 := &Instance{HostName: "b1", Status: UP}
+		apps := map[string]*Application{
+			"A": {Name: "A", Instances: []*Instance{a1, a2}},
+			"B": {Name: "B", Instances: []*Instance{b1}},
+		}
+
+		Convey("applying a delta adds, modifies, and deletes instances", func() {
+			result := applyDelta(apps, []*Application{
+				{Name: "A", Instances: []*Instance{
+					{HostName: "a2", Status: DOWN, ActionType: MODIFIED},
+					{HostName: "a3", Status: UP, ActionType: ADDED},
+					{HostName: "a1", ActionType: DELETED},
+				}},
+				{Name: "C", Instances: []*Instance{{HostName: "c1", Status: STARTING, ActionType: ADDED}}},
+			})
+			So(result, ShouldHaveLength, 3)
+			So(result["A"].Instances, ShouldHaveLength, 2)
+			So(result["A"].Instances[0].HostName, ShouldEqual, "a2")
+			So(result["A"].Instances[0].Status, ShouldEqual, DOWN)
+			So(result["A"].Instances[1].HostName, ShouldEqual, "a3")
+			So(result["B"], ShouldEqual, apps["B"])
+			So(result["C"].Instances[0].HostName, ShouldEqual, "c1")
+
+			Convey("leaving the original copy intact", func() {
+				So(apps["A"].Instances, ShouldResemble, []*Instance{a1, a2})
+				So(a2.Status, ShouldEqual, UP)
+			})
+		})
+
+		Convey("deleting an application's last instance removes the application", func() {
+			result := applyDelta(apps, []*Application{
+				{Name: "B", Instances: []*Instance{{HostName: "b1", ActionType: DELETED}}},
+				{Name: "D", Instances: []*Instance{{HostName: "d1", ActionType: DELETED}}},
+			})
+			So(result, ShouldHaveLength, 1)
+			So(result, ShouldContainKey, "A")
+		})
+	})
+}
+
+func TestRegistryClient(t *testing.T) {
+	var full, delta string
+	var fullHits, deltaHits int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/apps":
+			fullHits++
+			fmt.Fprint(w, full)
+		case "/apps/delta":
+			deltaHits++
+			if len(delta) == 0 {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprint(w, delta)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	Convey("Given a registry client with deltas enabled", t, func() {
+		fullHits, deltaHits = 0, 0
+		full = appsXML("UP_2_", instanceXML("i-1", UP, ""), instanceXML("i-2", UP, ""))
+		delta = ""
+		e := NewConn(server.URL)
+		e.EnableDelta = true
+		c := e.NewRegistryClient()
+		So(c.Apps(), ShouldBeNil)
+
+		Convey("it first fetches the full registry", func() {
+			So(c.Refresh(ctx), ShouldBeNil)
+			So(fullHits, ShouldEqual, 1)
+			So(deltaHits, ShouldEqual, 0)
+			So(c.Apps()["TESTAPP"].Instances, ShouldHaveLength, 2)
+			So(c.Hashcode(), ShouldEqual, "UP_2_")
+
+			Convey("and then applies deltas whose hashcode matches", func() {
+				delta = appsXML("DOWN_1_UP_2_", instanceXML("i-2", DOWN, MODIFIED), instanceXML("i-3", UP, ADDED))
+				So(c.Refresh(ctx), ShouldBeNil)
+				So(fullHits, ShouldEqual, 1)
+				So(deltaHits, ShouldEqual, 1)
+				So(c.Apps()["TESTAPP"].Instances, ShouldHaveLength, 3)
+				So(c.Hashcode(), ShouldEqual, "DOWN_1_UP_2_")
+			})
+
+			Convey("and fetches the full registry again when the hashcode doesn't match", func() {
+				delta = appsXML("UP_4_", instanceXML("i-3", UP, ADDED))
+				full = appsXML("UP_3_", instanceXML("i-1", UP, ""), instanceXML("i-2", UP, ""), instanceXML("i-3", UP, ""))
+				So(c.Refresh(ctx), ShouldBeNil)
+				So(fullHits, ShouldEqual, 2)
+				So(deltaHits, ShouldEqual, 1)
+				So(c.Hashcode(), ShouldEqual, "UP_3_")
+			})
+
+			Convey("and fetches the full registry again when the delta is unavailable", func() {
+				So(c.Refresh(ctx), ShouldBeNil)
+				So(fullHits, ShouldEqual, 2)
+				So(deltaHits, ShouldEqual, 1)
+			})
+		})
+
+		Convey("without deltas enabled, it always fetches the full registry", func() {
+			e.EnableDelta = false
+			delta = appsXML("UP_2_")
+			So(c.Refresh(ctx), ShouldBeNil)
+			So(c.Refresh(ctx), ShouldBeNil)
+			So(fullHits, ShouldEqual, 2)
+			So(deltaHits, ShouldEqual, 0)
+		})
+	})
+}
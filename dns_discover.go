@@ -4,18 +4,26 @@ package fargo
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
-	"github.com/franela/goreq"
 	"github.com/miekg/dns"
 )
 
-const azURL = "http://169.254.169.254/latest/meta-data/placement/availability-zone"
-
 var ErrNotInAWS = fmt.Errorf("Not in AWS")
 
 func discoverDNS(domain string, port int, urlBase string) (servers []string, ttl time.Duration, err error) {
+	zones, ttl, err := discoverDNSByZone(domain, port, urlBase)
+	for _, zoneServers := range zones {
+		servers = append(servers, zoneServers...)
+	}
+	return
+}
+
+// discoverDNSByZone discovers the Eureka servers in the current region, grouped by the availability
+// zone in which they run.
+func discoverDNSByZone(domain string, port int, urlBase string) (zones map[string][]string, ttl time.Duration, err error) {
 	r, _ := region()
 
 	// all DNS queries must use the FQDN
@@ -29,14 +37,17 @@ func discoverDNS(domain string, port int, urlBase string) (servers []string, ttl
 		return
 	}
 
+	zones = make(map[string][]string, len(regionRecords))
 	for _, az := range regionRecords {
 		instances, _, er := retryingFindTXT("txt." + dns.Fqdn(az))
 		if er != nil {
 			continue
 		}
+		// The zone records are named like "us-east-1c.us-east-1.example.com".
+		zone := strings.SplitN(az, ".", 2)[0]
 		for _, instance := range instances {
 			// format the service URL
-			servers = append(servers, fmt.Sprintf("http://%s:%d/%s", instance, port, urlBase))
+			zones[zone] = append(zones[zone], fmt.Sprintf("http://%s:%d/%s", instance, port, urlBase))
 		}
 	}
 	return
@@ -112,20 +123,5 @@ func region() (string, error) {
 
 // defaults to us-east-1 if there's a problem
 func availabilityZone() (string, error) {
-	response, err := goreq.Request{Uri: azURL}.Do()
-	if err != nil {
-		return "", err
-	}
-	if response.StatusCode < 200 || response.StatusCode >= 300 {
-		body, _ := response.Body.ToString()
-		return "", fmt.Errorf("bad response code: code %d does not indicate successful request, body=%s",
-			response.StatusCode,
-			body,
-		)
-	}
-	zone, err := response.Body.ToString()
-	if err != nil {
-		return "", err
-	}
-	return zone, nil
+	return EC2MetadataSource{}.Get("placement/availability-zone")
 }
@@ -3,6 +3,7 @@ package fargo
 // MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
 
 import (
+	"errors"
 	"fmt"
 )
 
@@ -21,13 +22,43 @@ func (u *unsuccessfulHTTPResponse) Error() string {
 // HTTPResponseStatusCode extracts the HTTP status code for the response from Eureka that motivated
 // the supplied error, if any. If the returned present value is true, the returned code is an HTTP
 // status code.
+//
+// For an AllServersFailedError, it reports the status code from the last failed attempt.
 func HTTPResponseStatusCode(err error) (code int, present bool) {
-	if u, ok := err.(*unsuccessfulHTTPResponse); ok {
+	var u *unsuccessfulHTTPResponse
+	if errors.As(err, &u) {
 		return u.statusCode, true
 	}
 	return 0, false
 }
 
+// requestSetupError reports a failure to prepare a request to Eureka, such as to authenticate it or
+// to load the connection's TLS settings, before anything was sent. It says nothing about the
+// health of the Eureka server to which the request was bound.
+type requestSetupError struct {
+	err error
+}
+
+func (e *requestSetupError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the cause of the failure.
+func (e *requestSetupError) Unwrap() error {
+	return e.err
+}
+
+// isRequestSetupError reports whether the error arose while preparing a request, rather than
+// from sending it.
+func isRequestSetupError(err error) bool {
+	var setup *requestSetupError
+	return errors.As(err, &setup)
+}
+
+// ErrNoServiceURLs indicates that a connection has no Eureka service URLs to which to send
+// requests, such as when it was configured without any, or when DNS discovery found none.
+var ErrNoServiceURLs = errors.New("there are no Eureka ServiceUrls to choose from")
+
 type AppNotFoundError struct {
 	specific string
 }
@@ -35,3 +66,20 @@ type AppNotFoundError struct {
 func (e AppNotFoundError) Error() string {
 	return "Application not found for name=" + e.specific
 }
+
+// ErrRegistryUnavailable indicates that a Registry has yet to fetch the registry from Eureka
+// successfully.
+var ErrRegistryUnavailable = errors.New("the Eureka registry has not yet been fetched")
+
+type InstanceNotFoundError struct {
+	app string
+	id  string
+}
+
+func (e InstanceNotFoundError) Error() string {
+	return "Instance not found for id=" + e.id + " in application=" + e.app
+}
+
+// ErrNoInstancesAvailable indicates that a Balancer has no instances from which to choose, such as
+// when its InstanceSetSource has yet to acquire any, or the latest set is empty.
+var ErrNoInstancesAvailable = errors.New("there are no instances to choose from")
@@ -0,0 +1,95 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AttemptError records the failure of a single attempt to complete a request against one of the
+// connection's Eureka servers.
+type AttemptError struct {
+	// ServiceURL identifies the Eureka server, with any embedded password masked.
+	ServiceURL string
+	Err        error
+}
+
+func (e *AttemptError) Error() string {
+	return e.ServiceURL + ": " + e.Err.Error()
+}
+
+// Unwrap returns the cause of the failed attempt.
+func (e *AttemptError) Unwrap() error {
+	return e.Err
+}
+
+// AllServersFailedError reports that a request failed against every Eureka server attempted,
+// listing the failed attempts in the order they were made.
+type AllServersFailedError struct {
+	Attempts []*AttemptError
+}
+
+func (e *AllServersFailedError) Error() string {
+	msgs := make([]string, len(e.Attempts))
+	for i, a := range e.Attempts {
+		msgs[i] = a.Error()
+	}
+	return fmt.Sprintf("request failed against all %d Eureka servers attempted: %s", len(e.Attempts), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the error from the last attempt, such that HTTPResponseStatusCode reports the
+// status code from the last server to respond, if any.
+func (e *AllServersFailedError) Unwrap() error {
+	if len(e.Attempts) == 0 {
+		return nil
+	}
+	return e.Attempts[len(e.Attempts)-1]
+}
+
+// maxAttempts returns how many of the given number of candidate servers to try for a single
+// request. With Retries unset, every server is tried once; otherwise, a request is tried once and
+// then retried at most Retries times, each time against a different server.
+func (e *EurekaConnection) maxAttempts(candidates int) int {
+	if e.Retries > 0 && e.Retries < candidates {
+		return e.Retries + 1
+	}
+	return candidates
+}
+
+// failover makes the given attempt against the connection's Eureka servers in turn, stopping at
+// the first one that responds with a status code other than a server error (5xx). If every
+// server fails, it returns an AllServersFailedError describing each attempt. It stops early if the
+// supplied context is done, or if an attempt fails to prepare its request, which no other server
+// would fare better with and which doesn't count against the server. If the connection has no
+// service URLs, it returns ErrNoServiceURLs.
+func (e *EurekaConnection) failover(ctx context.Context, attempt func(serviceURL string) ([]byte, int, error)) ([]byte, int, error) {
+	candidates, err := e.serviceURLCandidates()
+	if err != nil {
+		return nil, -1, err
+	}
+	candidates = candidates[:e.maxAttempts(len(candidates))]
+	failures := make([]*AttemptError, 0, len(candidates))
+	for i, serviceURL := range candidates {
+		start := time.Now()
+		body, rcode, err := attempt(serviceURL)
+		if err == nil && rcode < http.StatusInternalServerError {
+			e.recordServerSuccess(serviceURL, time.Since(start))
+			return body, rcode, nil
+		}
+		if err == nil {
+			err = &unsuccessfulHTTPResponse{rcode, "Eureka server error"}
+		} else if ctx.Err() != nil || isRequestSetupError(err) {
+			return nil, rcode, err
+		}
+		e.recordServerFailure(serviceURL, err)
+		failures = append(failures, &AttemptError{redactURL(serviceURL), err})
+		if i < len(candidates)-1 {
+			log.Warningf("Request to Eureka server %s failed, trying another server, error: %s", redactURL(serviceURL), err.Error())
+		}
+	}
+	return nil, -1, &AllServersFailedError{failures}
+}
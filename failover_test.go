@@ -0,0 +1,159 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFailover(t *testing.T) {
+	var healthyHits, brokenHits int
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		healthyHits++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		brokenHits++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+	missing := httptest.NewServer(http.NotFoundHandler())
+	missing.Close()
+
+	heartbeat := func(e *EurekaConnection) error {
+		return e.HeartBeatInstance(&Instance{App: "TESTAPP", HostName: "i-123456"})
+	}
+
+	Convey("Given a connection with several service URLs", t, func() {
+		healthyHits, brokenHits = 0, 0
+
+		Convey("when only one server is healthy, every request reaches it", func() {
+			e := NewConn(missing.URL, broken.URL, healthy.URL)
+			defer e.Close()
+			for i := 0; i < 10; i++ {
+				So(heartbeat(&e), ShouldBeNil)
+			}
+			So(healthyHits, ShouldEqual, 10)
+		})
+
+		Convey("when no server is healthy, each is attempted once", func() {
+			e := NewConn(missing.URL, broken.URL)
+			defer e.Close()
+			err := heartbeat(&e)
+			So(err, ShouldNotBeNil)
+			var failed *AllServersFailedError
+			So(errors.As(err, &failed), ShouldBeTrue)
+			So(failed.Attempts, ShouldHaveLength, 2)
+			So(brokenHits, ShouldEqual, 1)
+			urls := []string{failed.Attempts[0].ServiceURL, failed.Attempts[1].ServiceURL}
+			So(urls, ShouldContain, missing.URL)
+			So(urls, ShouldContain, broken.URL)
+
+			Convey("and the status code from the last server to respond is available", func() {
+				e := NewConn(broken.URL)
+				defer e.Close()
+				err := heartbeat(&e)
+				So(err, shouldBearHTTPStatusCode, http.StatusServiceUnavailable)
+			})
+		})
+
+		Convey("when retries are limited, only that many other servers are attempted", func() {
+			e := NewConn(broken.URL, broken.URL, broken.URL, broken.URL)
+			defer e.Close()
+			e.Retries = 2
+			err := heartbeat(&e)
+			var failed *AllServersFailedError
+			So(errors.As(err, &failed), ShouldBeTrue)
+			So(failed.Attempts, ShouldHaveLength, 3)
+			So(brokenHits, ShouldEqual, 3)
+		})
+
+		Convey("a client error is not retried against other servers", func() {
+			notFoundHits := 0
+			notFound := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				notFoundHits++
+				w.WriteHeader(http.StatusNotFound)
+			}))
+			defer notFound.Close()
+			e := NewConn(notFound.URL, notFound.URL)
+			defer e.Close()
+			err := heartbeat(&e)
+			So(err, shouldBearHTTPStatusCode, http.StatusNotFound)
+			So(notFoundHits, ShouldEqual, 1)
+		})
+
+		Convey("a heartbeat logs only at debug level", func() {
+			e := NewConn(healthy.URL)
+			defer e.Close()
+			var buf bytes.Buffer
+			backend := logging.AddModuleLevel(logging.NewLogBackend(&buf, "", 0))
+			backend.SetLevel(logging.INFO, "")
+			log.SetBackend(backend)
+			defer log.SetBackend(logging.AddModuleLevel(logging.NewLogBackend(&bytes.Buffer{}, "", 0)))
+			So(heartbeat(&e), ShouldBeNil)
+			So(buf.String(), ShouldNotContainSubstring, "KV request")
+		})
+
+		Convey("a failure to prepare a request neither quarantines a server nor tries another", func() {
+			e := NewConn(broken.URL, healthy.URL)
+			defer e.Close()
+			unavailable := errors.New("token source unavailable")
+			e.Authenticator = AuthenticatorFunc(func(*http.Request) error {
+				return unavailable
+			})
+			_, err := e.GetApps()
+			So(errors.Is(err, unavailable), ShouldBeTrue)
+			So(healthyHits+brokenHits, ShouldEqual, 0)
+			for _, s := range e.ServerStates() {
+				So(s.Healthy, ShouldBeTrue)
+			}
+
+			Convey("as when TLS settings can't be loaded", func() {
+				e.Authenticator = nil
+				e.TLS = &TLSSettings{CertFile: "nonexistent.pem", KeyFile: "nonexistent.key"}
+				So(heartbeat(&e), ShouldNotBeNil)
+				So(healthyHits+brokenHits, ShouldEqual, 0)
+				for _, s := range e.ServerStates() {
+					So(s.Healthy, ShouldBeTrue)
+				}
+			})
+		})
+	})
+
+	Convey("Given a connection without any service URLs", t, func() {
+		e := NewConn()
+		defer e.Close()
+
+		Convey("selecting a service URL fails", func() {
+			_, err := e.SelectServiceURL()
+			So(err, ShouldEqual, ErrNoServiceURLs)
+		})
+
+		Convey("requests fail without reaching any server", func() {
+			So(errors.Is(heartbeat(&e), ErrNoServiceURLs), ShouldBeTrue)
+			_, err := e.GetApp("TESTAPP")
+			So(errors.Is(err, ErrNoServiceURLs), ShouldBeTrue)
+			err = e.RegisterInstance(validInstance())
+			So(errors.Is(err, ErrNoServiceURLs), ShouldBeTrue)
+		})
+	})
+}
+
+func shouldBearHTTPStatusCode(actual interface{}, expected ...interface{}) string {
+	code, present := HTTPResponseStatusCode(actual.(error))
+	if !present {
+		return "Expected an HTTP status code, but found none"
+	}
+	if code != expected[0] {
+		return ShouldEqual(code, expected[0])
+	}
+	return ""
+}
@@ -0,0 +1,81 @@
+package fargotest
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Fault intercepts a request before a Server handles it, simulating a misbehaving server. It
+// reports whether it responded to the request itself, in which case the Server does nothing
+// further with the request.
+type Fault func(w http.ResponseWriter, r *http.Request) bool
+
+// RespondWith is a Fault that responds to every request with the given HTTP status code.
+func RespondWith(status int) Fault {
+	return func(w http.ResponseWriter, r *http.Request) bool {
+		w.WriteHeader(status)
+		return true
+	}
+}
+
+// Delay is a Fault that waits for the given duration, or until the request is abandoned, before
+// letting the Server handle the request.
+func Delay(d time.Duration) Fault {
+	return func(w http.ResponseWriter, r *http.Request) bool {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+			return false
+		case <-r.Context().Done():
+			return true
+		}
+	}
+}
+
+// DropConnection is a Fault that closes the connection without responding to the request.
+func DropConnection() Fault {
+	return func(w http.ResponseWriter, r *http.Request) bool {
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return true
+		}
+		conn, _, err := hj.Hijack()
+		if err == nil {
+			conn.Close()
+		}
+		return true
+	}
+}
+
+// Matching restricts the given fault to requests with the given method whose paths begin with the
+// given prefix. An empty method matches any method.
+func Matching(method, pathPrefix string, f Fault) Fault {
+	return func(w http.ResponseWriter, r *http.Request) bool {
+		if (method != "" && r.Method != method) || !strings.HasPrefix(r.URL.Path, pathPrefix) {
+			return false
+		}
+		return f(w, r)
+	}
+}
+
+// Times restricts the given fault to the next n requests it sees, after which it lets the Server
+// handle requests normally.
+func Times(n int, f Fault) Fault {
+	var m sync.Mutex
+	return func(w http.ResponseWriter, r *http.Request) bool {
+		m.Lock()
+		if n <= 0 {
+			m.Unlock()
+			return false
+		}
+		n--
+		m.Unlock()
+		return f(w, r)
+	}
+}
@@ -0,0 +1,590 @@
+// Package fargotest provides an in-process stand-in for a Eureka server, for use in tests of code
+// that talks to Eureka through fargo.
+//
+// The Server implements the parts of Eureka's REST API that fargo uses—fetching the registry, its
+// applications and instances, and its VIP addresses, and registering, renewing, updating, and
+// deregistering instances—in both XML and JSON. It expires instances whose leases lapse, records
+// the requests it receives, and accepts Faults to simulate a misbehaving server.
+package fargotest
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hudl/fargo"
+)
+
+// DefaultLeaseDuration is how long the Server retains an instance without a heartbeat when the
+// instance's LeaseInfo doesn't specify a duration, matching Eureka's default.
+const DefaultLeaseDuration = 90 * time.Second
+
+// deltaRetention is how long the Server reports a change in the registry delta, matching Eureka's
+// default.
+const deltaRetention = 3 * time.Minute
+
+// Request records a request received by a Server.
+type Request struct {
+	Method string
+	// Path is the request's path, such as "/apps/TESTAPP".
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+	Time   time.Time
+}
+
+type lease struct {
+	ins         *fargo.Instance
+	lastRenewal time.Time
+}
+
+type change struct {
+	ins  *fargo.Instance
+	time time.Time
+}
+
+// Server is a fake Eureka server listening on a local address. Its methods are safe for
+// concurrent use.
+type Server struct {
+	server *httptest.Server
+	m      sync.Mutex
+	// leases holds the registered instances, keyed by upper-case application name and then by
+	// instance ID.
+	leases    map[string]map[string]*lease
+	overrides map[string]fargo.StatusType
+	changes   []change
+	version   int
+	requests  []Request
+	faults    []Fault
+	now       func() time.Time
+}
+
+// NewServer starts a Server with an empty registry. The caller should call Close when finished,
+// to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		leases:    make(map[string]map[string]*lease),
+		overrides: make(map[string]fargo.StatusType),
+		now:       time.Now,
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// URL returns the server's base URL, suitable for use as a fargo service URL.
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// Conn returns a connection to the server.
+func (s *Server) Conn() fargo.EurekaConnection {
+	return fargo.NewConn(s.URL())
+}
+
+// Close shuts down the server, blocking until all outstanding requests have completed.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// SetClock replaces the source of the current time the server uses to expire leases and report
+// changes, allowing tests to advance time at will. A nil clock restores the system clock.
+func (s *Server) SetClock(now func() time.Time) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if now == nil {
+		now = time.Now
+	}
+	s.now = now
+}
+
+// Register adds the given instance to the registry directly, as if it had registered itself,
+// replacing any instance with the same application and ID. The server stores a copy of the
+// instance, so later changes to the supplied Instance don't affect the registry.
+func (s *Server) Register(ins *fargo.Instance) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.register(copyInstance(ins))
+}
+
+// Expire evicts the given instance from the registry, as Eureka does once an instance's lease
+// lapses. It reports whether the instance was registered.
+func (s *Server) Expire(app, id string) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.remove(app, id)
+}
+
+// Instance returns a copy of the given registered instance, or nil if it's not registered.
+func (s *Server) Instance(app, id string) *fargo.Instance {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.expireLeases()
+	if l := s.lease(app, id); l != nil {
+		return copyInstance(l.ins)
+	}
+	return nil
+}
+
+// Instances returns copies of all the registered instances, ordered by application name and
+// then by ID.
+func (s *Server) Instances() []*fargo.Instance {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.expireLeases()
+	var instances []*fargo.Instance
+	for _, app := range s.applications(nil) {
+		for _, ins := range app.Instances {
+			instances = append(instances, copyInstance(ins))
+		}
+	}
+	return instances
+}
+
+// Requests returns the requests the server has received, in the order it received them.
+func (s *Server) Requests() []Request {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// ClearRequests discards the record of the requests the server has received.
+func (s *Server) ClearRequests() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.requests = nil
+}
+
+// InjectFault adds the given fault, which the server consults before handling each subsequent
+// request, after any faults added earlier.
+func (s *Server) InjectFault(f Fault) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.faults = append(s.faults, f)
+}
+
+// ClearFaults removes all injected faults.
+func (s *Server) ClearFaults() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.faults = nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	s.m.Lock()
+	s.requests = append(s.requests, Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+		Body:   body,
+		Time:   s.now(),
+	})
+	faults := append([]Fault(nil), s.faults...)
+	s.m.Unlock()
+	for _, f := range faults {
+		if f(w, r) {
+			return
+		}
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.expireLeases()
+	useJSON := strings.Contains(r.Header.Get("Accept"), "json")
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "apps":
+		s.getApps(w, r, useJSON)
+	case len(parts) == 2 && parts[0] == "apps" && parts[1] == "delta" && r.Method == "GET":
+		s.getDelta(w, r, useJSON)
+	case len(parts) == 2 && parts[0] == "apps":
+		s.serveApp(w, r, parts[1], useJSON)
+	case len(parts) == 3 && parts[0] == "apps":
+		s.serveInstance(w, r, parts[1], parts[2], useJSON)
+	case len(parts) == 4 && parts[0] == "apps" && parts[3] == "status":
+		s.serveStatus(w, r, parts[1], parts[2])
+	case len(parts) == 4 && parts[0] == "apps" && parts[3] == "metadata":
+		s.serveMetadata(w, r, parts[1], parts[2])
+	case len(parts) == 2 && (parts[0] == "vips" || parts[0] == "svips"):
+		s.getVIP(w, r, parts[1], parts[0] == "svips", useJSON)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *Server) getApps(w http.ResponseWriter, r *http.Request, useJSON bool) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeApps(w, s.appsResponse(s.applications(nil)), useJSON)
+}
+
+func (s *Server) getDelta(w http.ResponseWriter, r *http.Request, useJSON bool) {
+	byApp := make(map[string]*fargo.Application)
+	var names []string
+	for _, c := range s.changes {
+		app, ok := byApp[c.ins.App]
+		if !ok {
+			app = &fargo.Application{Name: c.ins.App}
+			byApp[c.ins.App] = app
+			names = append(names, c.ins.App)
+		}
+		app.Instances = append(app.Instances, c.ins)
+	}
+	sort.Strings(names)
+	apps := make([]*fargo.Application, len(names))
+	for i, name := range names {
+		apps[i] = byApp[name]
+	}
+	writeApps(w, s.appsResponse(apps), useJSON)
+}
+
+func (s *Server) getVIP(w http.ResponseWriter, r *http.Request, addr string, secure bool, useJSON bool) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	apps := s.applications(func(ins *fargo.Instance) bool {
+		vips := ins.VipAddress
+		if secure {
+			vips = ins.SecureVipAddress
+		}
+		for _, vip := range strings.Split(vips, ",") {
+			if strings.EqualFold(strings.TrimSpace(vip), addr) {
+				return true
+			}
+		}
+		return false
+	})
+	writeApps(w, s.appsResponse(apps), useJSON)
+}
+
+func (s *Server) serveApp(w http.ResponseWriter, r *http.Request, name string, useJSON bool) {
+	switch r.Method {
+	case "GET":
+		name = strings.ToUpper(name)
+		apps := s.applications(func(ins *fargo.Instance) bool { return ins.App == name })
+		if len(apps) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if useJSON {
+			writeJSON(w, fargo.GetAppResponseJson{Application: *apps[0]})
+		} else {
+			writeXML(w, "application", apps[0])
+		}
+	case "POST":
+		ins, err := decodeInstance(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if ins.App == "" {
+			ins.App = name
+		}
+		s.register(ins)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) serveInstance(w http.ResponseWriter, r *http.Request, app, id string, useJSON bool) {
+	l := s.lease(app, id)
+	if l == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case "GET":
+		if useJSON {
+			writeJSON(w, fargo.RegisterInstanceJson{Instance: l.ins})
+		} else {
+			writeXML(w, "instance", l.ins)
+		}
+	case "PUT":
+		l.lastRenewal = s.now()
+		l.ins.LeaseInfo.LastRenewalTimestamp = millis(l.lastRenewal)
+		w.WriteHeader(http.StatusOK)
+	case "DELETE":
+		s.remove(app, id)
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) serveStatus(w http.ResponseWriter, r *http.Request, app, id string) {
+	l := s.lease(app, id)
+	if l == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	status := fargo.StatusType(r.URL.Query().Get("value"))
+	switch r.Method {
+	case "PUT":
+		if status == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.overrides[overrideKey(l.ins)] = status
+		l.ins.Overriddenstatus = status
+		l.ins.Status = status
+	case "DELETE":
+		delete(s.overrides, overrideKey(l.ins))
+		if status == "" {
+			status = fargo.UNKNOWN
+		}
+		l.ins.Overriddenstatus = fargo.UNKNOWN
+		l.ins.Status = status
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	s.recordChange(l.ins, fargo.MODIFIED)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) serveMetadata(w http.ResponseWriter, r *http.Request, app, id string) {
+	if r.Method != "PUT" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	l := s.lease(app, id)
+	if l == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	for k, vs := range r.URL.Query() {
+		l.ins.SetMetadataString(k, vs[len(vs)-1])
+	}
+	s.recordChange(l.ins, fargo.MODIFIED)
+	w.WriteHeader(http.StatusOK)
+}
+
+// register adds the instance to the registry, filling in the details Eureka supplies. The
+// caller must hold s.m.
+func (s *Server) register(ins *fargo.Instance) {
+	ins.App = strings.ToUpper(ins.App)
+	now := s.now()
+	if ins.Status == "" {
+		ins.Status = fargo.UP
+	}
+	if override, ok := s.overrides[overrideKey(ins)]; ok {
+		ins.Overriddenstatus = override
+		ins.Status = override
+	} else {
+		ins.Overriddenstatus = fargo.UNKNOWN
+	}
+	if ins.LeaseInfo.RenewalIntervalInSecs == 0 {
+		ins.LeaseInfo.RenewalIntervalInSecs = 30
+	}
+	if ins.LeaseInfo.DurationInSecs == 0 {
+		ins.LeaseInfo.DurationInSecs = int32(DefaultLeaseDuration / time.Second)
+	}
+	ins.LeaseInfo.RegistrationTimestamp = millis(now)
+	ins.LeaseInfo.LastRenewalTimestamp = millis(now)
+	ins.LeaseInfo.ServiceUpTimestamp = millis(now)
+	ins.LeaseInfo.EvictionTimestamp = 0
+	instances, ok := s.leases[ins.App]
+	if !ok {
+		instances = make(map[string]*lease)
+		s.leases[ins.App] = instances
+	}
+	instances[ins.Id()] = &lease{ins, now}
+	s.recordChange(ins, fargo.ADDED)
+}
+
+// remove removes the instance from the registry, reporting whether it was registered. The caller
+// must hold s.m.
+func (s *Server) remove(app, id string) bool {
+	l := s.lease(app, id)
+	if l == nil {
+		return false
+	}
+	app = strings.ToUpper(app)
+	delete(s.leases[app], id)
+	if len(s.leases[app]) == 0 {
+		delete(s.leases, app)
+	}
+	delete(s.overrides, overrideKey(l.ins))
+	s.recordChange(l.ins, fargo.DELETED)
+	return true
+}
+
+// lease returns the lease of the given instance, or nil if it's not registered. The caller must
+// hold s.m.
+func (s *Server) lease(app, id string) *lease {
+	return s.leases[strings.ToUpper(app)][id]
+}
+
+// expireLeases evicts the instances whose leases have lapsed, and forgets changes too old to
+// report in a delta. The caller must hold s.m.
+func (s *Server) expireLeases() {
+	now := s.now()
+	for _, instances := range s.leases {
+		for id, l := range instances {
+			duration := time.Duration(l.ins.LeaseInfo.DurationInSecs) * time.Second
+			if now.Sub(l.lastRenewal) > duration {
+				s.remove(l.ins.App, id)
+			}
+		}
+	}
+	i := 0
+	for i < len(s.changes) && now.Sub(s.changes[i].time) > deltaRetention {
+		i++
+	}
+	s.changes = s.changes[i:]
+}
+
+// recordChange notes a change to the registry for inclusion in the delta. The caller must hold
+// s.m.
+func (s *Server) recordChange(ins *fargo.Instance, action fargo.ActionType) {
+	c := copyInstance(ins)
+	c.ActionType = action
+	s.changes = append(s.changes, change{c, s.now()})
+	s.version++
+}
+
+// applications returns the registered applications, including only those instances that satisfy
+// the given predicate, if any. The caller must hold s.m.
+func (s *Server) applications(pred func(*fargo.Instance) bool) []*fargo.Application {
+	names := make([]string, 0, len(s.leases))
+	for name := range s.leases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var apps []*fargo.Application
+	for _, name := range names {
+		app := &fargo.Application{Name: name}
+		for _, l := range s.leases[name] {
+			if pred == nil || pred(l.ins) {
+				app.Instances = append(app.Instances, l.ins)
+			}
+		}
+		if len(app.Instances) == 0 {
+			continue
+		}
+		sort.Slice(app.Instances, func(i, j int) bool {
+			return app.Instances[i].Id() < app.Instances[j].Id()
+		})
+		apps = append(apps, app)
+	}
+	return apps
+}
+
+// appsResponse wraps the given applications, reporting the hash code of the full registry. The
+// caller must hold s.m.
+func (s *Server) appsResponse(apps []*fargo.Application) *fargo.GetAppsResponse {
+	counts := make(map[string]int)
+	for _, instances := range s.leases {
+		for _, l := range instances {
+			counts[string(l.ins.Status)]++
+		}
+	}
+	statuses := make([]string, 0, len(counts))
+	for status := range counts {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	var hashcode strings.Builder
+	for _, status := range statuses {
+		hashcode.WriteString(status + "_" + strconv.Itoa(counts[status]) + "_")
+	}
+	return &fargo.GetAppsResponse{
+		Applications:  apps,
+		AppsHashcode:  hashcode.String(),
+		VersionsDelta: s.version,
+	}
+}
+
+func overrideKey(ins *fargo.Instance) string {
+	return ins.App + "/" + ins.Id()
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func decodeInstance(r *http.Request) (*fargo.Instance, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	var ins *fargo.Instance
+	if strings.Contains(r.Header.Get("Content-Type"), "json") {
+		var wrapped fargo.RegisterInstanceJson
+		err = json.Unmarshal(body, &wrapped)
+		ins = wrapped.Instance
+	} else {
+		err = xml.Unmarshal(body, &ins)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ins == nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return ins, parseMetadata(ins)
+}
+
+// copyInstance copies the instance, including its metadata, so that the copy can be changed
+// without disturbing the original.
+func copyInstance(ins *fargo.Instance) *fargo.Instance {
+	c := *ins
+	c.Metadata = fargo.InstanceMetadata{Raw: append([]byte(nil), ins.Metadata.Raw...)}
+	c.UniqueID = nil
+	if ins.UniqueID != nil {
+		c.InstanceId = ins.Id()
+	}
+	parseMetadata(&c)
+	return &c
+}
+
+// parseMetadata parses the instance's metadata, so that it's encoded correctly in either format.
+func parseMetadata(ins *fargo.Instance) error {
+	return (&fargo.Application{Instances: []*fargo.Instance{ins}}).ParseAllMetadata()
+}
+
+func writeApps(w http.ResponseWriter, r *fargo.GetAppsResponse, useJSON bool) {
+	if useJSON {
+		writeJSON(w, fargo.GetAppsResponseJson{Response: r})
+	} else {
+		writeXML(w, "applications", r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func writeXML(w http.ResponseWriter, name string, v interface{}) {
+	var b bytes.Buffer
+	if err := xml.NewEncoder(&b).EncodeElement(v, xml.StartElement{Name: xml.Name{Local: name}}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write(b.Bytes())
+}
@@ -0,0 +1,228 @@
+package fargotest
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hudl/fargo"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func testInstance(hostName string) *fargo.Instance {
+	return &fargo.Instance{
+		HostName:         hostName,
+		App:              "TESTAPP",
+		IPAddr:           "127.0.0.10",
+		VipAddress:       "testapp",
+		SecureVipAddress: "testapp-secure",
+		Port:             9090,
+		PortEnabled:      true,
+		DataCenterInfo:   fargo.DataCenterInfo{Name: fargo.MyOwn},
+		Status:           fargo.UP,
+	}
+}
+
+func TestServer(t *testing.T) {
+	for _, useJSON := range []bool{false, true} {
+		Convey("Given a fake Eureka server", t, func() {
+			s := NewServer()
+			defer s.Close()
+			e := s.Conn()
+			e.UseJson = useJSON
+			ins := testInstance("i-123456")
+			So(e.RegisterInstance(ins), ShouldBeNil)
+
+			Convey("a registered instance appears in the registry", func() {
+				apps, err := e.GetApps()
+				So(err, ShouldBeNil)
+				So(apps["TESTAPP"].Instances, ShouldHaveLength, 1)
+				app, err := e.GetApp("TESTAPP")
+				So(err, ShouldBeNil)
+				So(app.Instances[0].Port, ShouldEqual, 9090)
+				got, err := e.GetInstance("TESTAPP", "i-123456")
+				So(err, ShouldBeNil)
+				So(got.IPAddr, ShouldEqual, "127.0.0.10")
+				So(got.LeaseInfo.RegistrationTimestamp, ShouldBeGreaterThan, 0)
+				So(s.Instance("TESTAPP", "i-123456"), ShouldNotBeNil)
+			})
+
+			Convey("its instances can be found by VIP address", func() {
+				instances, err := e.GetInstancesByVIPAddress("testapp", false)
+				So(err, ShouldBeNil)
+				So(instances, ShouldHaveLength, 1)
+				instances, err = e.GetInstancesByVIPAddress("testapp-secure", true)
+				So(err, ShouldBeNil)
+				So(instances, ShouldHaveLength, 1)
+				instances, err = e.GetInstancesByVIPAddress("nonexistent", false)
+				So(err, ShouldBeNil)
+				So(instances, ShouldBeEmpty)
+			})
+
+			Convey("an unknown application or instance is not found", func() {
+				_, err := e.GetApp("NONEXISTENT")
+				So(err, ShouldHaveSameTypeAs, fargo.AppNotFoundError{})
+				err = e.HeartBeatInstance(testInstance("i-nonexistent"))
+				code, ok := fargo.HTTPResponseStatusCode(err)
+				So(ok, ShouldBeTrue)
+				So(code, ShouldEqual, http.StatusNotFound)
+			})
+
+			Convey("status overrides can be set and removed", func() {
+				So(e.UpdateInstanceStatus(ins, fargo.OUTOFSERVICE), ShouldBeNil)
+				got := s.Instance("TESTAPP", "i-123456")
+				So(got.Status, ShouldEqual, fargo.OUTOFSERVICE)
+				So(got.Overriddenstatus, ShouldEqual, fargo.OUTOFSERVICE)
+
+				Convey("and survive registering again", func() {
+					So(e.ReregisterInstance(testInstance("i-123456")), ShouldBeNil)
+					So(s.Instance("TESTAPP", "i-123456").Status, ShouldEqual, fargo.OUTOFSERVICE)
+				})
+
+				Convey("until removed", func() {
+					So(e.RemoveStatusOverride(ins, fargo.UP), ShouldBeNil)
+					got, err := e.GetInstance("TESTAPP", "i-123456")
+					So(err, ShouldBeNil)
+					So(got.Status, ShouldEqual, fargo.UP)
+					So(got.Overriddenstatus, ShouldEqual, fargo.UNKNOWN)
+				})
+			})
+
+			Convey("metadata can be updated", func() {
+				So(e.UpdateMetadata(ins, map[string]string{"a": "one", "b": "two"}), ShouldBeNil)
+				got, err := e.GetInstance("TESTAPP", "i-123456")
+				So(err, ShouldBeNil)
+				v, err := got.Metadata.GetString("b")
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, "two")
+			})
+
+			Convey("a deregistered instance leaves the registry", func() {
+				So(e.DeregisterInstance(ins), ShouldBeNil)
+				So(s.Instances(), ShouldBeEmpty)
+				_, err := e.GetInstance("TESTAPP", "i-123456")
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("the requests received are recorded", func() {
+				s.ClearRequests()
+				So(e.HeartBeatInstance(ins), ShouldBeNil)
+				requests := s.Requests()
+				So(requests, ShouldHaveLength, 1)
+				So(requests[0].Method, ShouldEqual, "PUT")
+				So(requests[0].Path, ShouldEqual, "/apps/TESTAPP/i-123456")
+			})
+		})
+	}
+
+	Convey("Given a fake Eureka server with a controlled clock", t, func() {
+		s := NewServer()
+		defer s.Close()
+		var m sync.Mutex
+		now := time.Now()
+		s.SetClock(func() time.Time {
+			m.Lock()
+			defer m.Unlock()
+			return now
+		})
+		advance := func(d time.Duration) {
+			m.Lock()
+			defer m.Unlock()
+			now = now.Add(d)
+		}
+		e := s.Conn()
+		ins := testInstance("i-123456")
+		ins.LeaseInfo.DurationInSecs = 10
+		So(e.RegisterInstance(ins), ShouldBeNil)
+
+		Convey("heartbeats keep an instance registered", func() {
+			for i := 0; i < 3; i++ {
+				advance(8 * time.Second)
+				So(e.HeartBeatInstance(ins), ShouldBeNil)
+			}
+			So(s.Instance("TESTAPP", "i-123456"), ShouldNotBeNil)
+		})
+
+		Convey("an instance is evicted once its lease lapses", func() {
+			advance(11 * time.Second)
+			So(s.Instance("TESTAPP", "i-123456"), ShouldBeNil)
+			err := e.HeartBeatInstance(ins)
+			code, ok := fargo.HTTPResponseStatusCode(err)
+			So(ok, ShouldBeTrue)
+			So(code, ShouldEqual, http.StatusNotFound)
+		})
+
+		Convey("an instance can be evicted on demand", func() {
+			So(s.Expire("TESTAPP", "i-123456"), ShouldBeTrue)
+			So(s.Expire("TESTAPP", "i-123456"), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a fake Eureka server with injected faults", t, func() {
+		s := NewServer()
+		defer s.Close()
+		e := s.Conn()
+		s.Register(testInstance("i-123456"))
+
+		Convey("a server error is reported as such", func() {
+			s.InjectFault(Times(1, RespondWith(http.StatusServiceUnavailable)))
+			_, err := e.GetApps()
+			So(err, ShouldNotBeNil)
+
+			Convey("and the fault lapses as specified", func() {
+				_, err := e.GetApps()
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("a fault can target particular requests", func() {
+			s.InjectFault(Matching("PUT", "/apps/", RespondWith(http.StatusNotFound)))
+			_, err := e.GetApps()
+			So(err, ShouldBeNil)
+			So(e.HeartBeatInstance(testInstance("i-123456")), ShouldNotBeNil)
+
+			Convey("until the faults are cleared", func() {
+				s.ClearFaults()
+				So(e.HeartBeatInstance(testInstance("i-123456")), ShouldBeNil)
+			})
+		})
+
+		Convey("a dropped connection fails the request", func() {
+			s.InjectFault(DropConnection())
+			_, err := e.GetApps()
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("a delayed response can outlast the caller", func() {
+			s.InjectFault(Delay(time.Second))
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			_, err := e.GetAppsContext(ctx)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("A registry client keeps current with the fake server's delta", t, func() {
+		s := NewServer()
+		defer s.Close()
+		e := s.Conn()
+		e.EnableDelta = true
+		s.Register(testInstance("i-123456"))
+		c := e.NewRegistryClient()
+		ctx := context.Background()
+		So(c.Refresh(ctx), ShouldBeNil)
+		So(c.Apps()["TESTAPP"].Instances, ShouldHaveLength, 1)
+
+		s.Register(testInstance("i-234567"))
+		s.ClearRequests()
+		So(c.Refresh(ctx), ShouldBeNil)
+		So(c.Apps()["TESTAPP"].Instances, ShouldHaveLength, 2)
+		requests := s.Requests()
+		So(requests, ShouldHaveLength, 1)
+		So(requests[0].Path, ShouldEqual, "/apps/delta")
+	})
+}
@@ -0,0 +1,13 @@
+module github.com/hudl/fargo/grpcresolver
+
+go 1.16
+
+require (
+	github.com/hudl/fargo v1.4.0
+	github.com/op/go-logging v0.0.0-20160315200505-970db520ece7
+	github.com/smartystreets/goconvey v1.6.4
+	google.golang.org/grpc v1.42.0
+)
+
+// Build against the fargo package alongside this one.
+replace github.com/hudl/fargo => ../
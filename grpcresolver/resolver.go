@@ -0,0 +1,230 @@
+// Package grpcresolver lets gRPC clients find their servers through Eureka. It provides a
+// resolver.Builder for the "eureka" scheme, resolving targets of the form "eureka:///vip-address"
+// to the addresses of the instances registered with that Eureka VIP address.
+//
+//	resolver.Register(grpcresolver.NewBuilder(&conn, grpcresolver.Options{}))
+//	cc, err := grpc.Dial("eureka:///my-service", grpc.WithInsecure())
+//
+// Each resolved address carries the ID, metadata, and availability zone of its instance as
+// balancer attributes, available to load balancing policies through InstanceID, Metadata, and
+// Zone.
+//
+// This package is a module of its own, so that only programs using it depend on gRPC.
+package grpcresolver
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hudl/fargo"
+	"github.com/op/go-logging"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+)
+
+var log = logging.MustGetLogger("fargo.grpcresolver")
+
+// Scheme is the URI scheme for which a Builder resolves targets.
+const Scheme = "eureka"
+
+// Options adjusts which instances a Builder's resolvers offer to gRPC. The zero value selects
+// the defaults.
+type Options struct {
+	// Statuses lists the statuses of the instances to offer. It defaults to UP alone.
+	Statuses []fargo.StatusType
+	// Secure directs the resolvers to treat targets as secure VIP addresses, offering each
+	// instance's SecurePort rather than its Port.
+	Secure bool
+	// UseHostName directs the resolvers to offer each instance's HostName rather than its IPAddr
+	// as its address.
+	UseHostName bool
+}
+
+type builder struct {
+	e    *fargo.EurekaConnection
+	opts Options
+}
+
+// NewBuilder returns a resolver.Builder for the "eureka" scheme that polls Eureka for instances
+// over the given connection, at its configured polling interval. Register it with gRPC using
+// resolver.Register, or supply it to a single ClientConn using grpc.WithResolvers.
+func NewBuilder(e *fargo.EurekaConnection, opts Options) resolver.Builder {
+	return &builder{e: e, opts: opts}
+}
+
+func (b *builder) Scheme() string {
+	return Scheme
+}
+
+func (b *builder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	vip := strings.TrimPrefix(target.Endpoint, "/")
+	if vip == "" {
+		return nil, errors.New("eureka target names no VIP address")
+	}
+	queryOpts := []fargo.InstanceQueryOption{fargo.ThatAreUp}
+	if len(b.opts.Statuses) > 0 {
+		queryOpts = queryOpts[:0]
+		for _, s := range b.opts.Statuses {
+			queryOpts = append(queryOpts, fargo.WithStatus(s))
+		}
+	}
+	done := make(chan struct{})
+	// Await the first update, so that the ClientConn needn't wait a full polling interval for
+	// its first addresses.
+	updates, err := b.e.ScheduleVIPAddressUpdates(vip, b.opts.Secure, true, done, queryOpts...)
+	if err != nil {
+		return nil, err
+	}
+	r := &eurekaResolver{
+		vip:         vip,
+		secure:      b.opts.Secure,
+		useHostName: b.opts.UseHostName,
+		cc:          cc,
+		done:        done,
+	}
+	go r.watch(updates)
+	return r, nil
+}
+
+type eurekaResolver struct {
+	vip         string
+	secure      bool
+	useHostName bool
+	cc          resolver.ClientConn
+	closeOnce   sync.Once
+	done        chan struct{}
+}
+
+func (r *eurekaResolver) watch(updates <-chan fargo.InstanceSetUpdate) {
+	var succeeded bool
+	for u := range updates {
+		if u.Err != nil {
+			// Keep offering the last set of instances rather than failing calls that could still
+			// succeed against them.
+			if succeeded {
+				log.Warningf("Failed to update instances for VIP address %s, retaining the last set: %s", r.vip, u.Err)
+			} else {
+				r.cc.ReportError(u.Err)
+			}
+			continue
+		}
+		addrs := make([]resolver.Address, 0, len(u.Instances))
+		for _, ins := range u.Instances {
+			if addr, ok := r.address(ins); ok {
+				addrs = append(addrs, addr)
+			}
+		}
+		if len(addrs) == 0 {
+			r.cc.ReportError(fmt.Errorf("no instances are available for Eureka VIP address %s", r.vip))
+			continue
+		}
+		succeeded = true
+		if err := r.cc.UpdateState(resolver.State{Addresses: addrs}); err != nil {
+			log.Warningf("gRPC rejected the instances for VIP address %s: %s", r.vip, err)
+		}
+	}
+}
+
+func (r *eurekaResolver) address(ins *fargo.Instance) (resolver.Address, bool) {
+	port := ins.Port
+	if r.secure {
+		port = ins.SecurePort
+	}
+	if port <= 0 {
+		return resolver.Address{}, false
+	}
+	host := ins.IPAddr
+	if r.useHostName || host == "" {
+		host = ins.HostName
+	}
+	metadata := metadataOf(ins)
+	zone := ins.DataCenterInfo.Metadata.AvailabilityZone
+	if zone == "" {
+		zone = metadata["zone"]
+	}
+	// Balancer attributes must compare equal across updates for an unchanged instance, so carry
+	// the instance's ID rather than the instance itself.
+	return resolver.Address{
+		Addr:       net.JoinHostPort(host, strconv.Itoa(port)),
+		ServerName: ins.HostName,
+		BalancerAttributes: attributes.New(instanceIDKey{}, ins.Id()).
+			WithValue(metadataKey{}, metadata).
+			WithValue(zoneKey{}, zone),
+	}, true
+}
+
+// ResolveNow does nothing, as the resolver polls Eureka on its own schedule.
+func (r *eurekaResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+// Close stops polling Eureka. It doesn't wait for an update in progress to finish, since gRPC
+// may call Close while holding locks that delivering that update requires; gRPC discards any
+// update from a closed resolver.
+func (r *eurekaResolver) Close() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+}
+
+type instanceIDKey struct{}
+type metadataKey struct{}
+type zoneKey struct{}
+
+// instanceMetadata holds an instance's metadata, with each value rendered as a string. It
+// compares equal to another with the same content, as gRPC requires of attributes.
+type instanceMetadata map[string]string
+
+func (m instanceMetadata) Equal(o interface{}) bool {
+	om, ok := o.(instanceMetadata)
+	if !ok || len(m) != len(om) {
+		return false
+	}
+	for k, v := range m {
+		if ov, ok := om[k]; !ok || ov != v {
+			return false
+		}
+	}
+	return true
+}
+
+// InstanceID returns the ID of the Eureka instance behind an address offered by a Builder's
+// resolver, or an empty string if the address didn't come from such a resolver.
+func InstanceID(addr resolver.Address) string {
+	id, _ := addr.BalancerAttributes.Value(instanceIDKey{}).(string)
+	return id
+}
+
+// Metadata returns the metadata of the Eureka instance behind an address offered by a Builder's
+// resolver, with each value rendered as a string. Callers must not modify the returned map.
+func Metadata(addr resolver.Address) map[string]string {
+	m, _ := addr.BalancerAttributes.Value(metadataKey{}).(instanceMetadata)
+	return m
+}
+
+// Zone returns the availability zone of the Eureka instance behind an address offered by a
+// Builder's resolver: that of its AWS data center, or else the value of its "zone" metadata key.
+// It returns an empty string if the zone is unknown.
+func Zone(addr resolver.Address) string {
+	z, _ := addr.BalancerAttributes.Value(zoneKey{}).(string)
+	return z
+}
+
+// metadataOf parses the instance's metadata, rendering each value as a string. It parses a copy,
+// leaving the instance as it was delivered.
+func metadataOf(ins *fargo.Instance) instanceMetadata {
+	parsed := &fargo.Instance{HostName: ins.HostName, Metadata: ins.Metadata}
+	app := &fargo.Application{Name: ins.App, Instances: []*fargo.Instance{parsed}}
+	if err := app.ParseAllMetadata(); err != nil {
+		return nil
+	}
+	m := make(instanceMetadata, len(parsed.Metadata.GetMap()))
+	for k, v := range parsed.Metadata.GetMap() {
+		m[k] = fmt.Sprint(v)
+	}
+	return m
+}
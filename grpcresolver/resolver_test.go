@@ -0,0 +1,173 @@
+package grpcresolver_test
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hudl/fargo"
+	"github.com/hudl/fargo/fargotest"
+	"github.com/hudl/fargo/grpcresolver"
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// clientConn records the states and errors that a resolver reports.
+type clientConn struct {
+	states chan resolver.State
+	errs   chan error
+}
+
+func newClientConn() *clientConn {
+	return &clientConn{
+		states: make(chan resolver.State, 10),
+		errs:   make(chan error, 10),
+	}
+}
+
+func (c *clientConn) UpdateState(s resolver.State) error {
+	c.states <- s
+	return nil
+}
+
+func (c *clientConn) ReportError(err error) {
+	c.errs <- err
+}
+
+func (c *clientConn) NewAddress([]resolver.Address) {}
+
+func (c *clientConn) NewServiceConfig(string) {}
+
+func (c *clientConn) ParseServiceConfig(string) *serviceconfig.ParseResult {
+	return nil
+}
+
+func testInstance(hostName string, port int, status fargo.StatusType) *fargo.Instance {
+	return &fargo.Instance{
+		HostName:       hostName,
+		App:            "TESTAPP",
+		IPAddr:         "127.0.0.1",
+		VipAddress:     "testapp",
+		Port:           port,
+		PortEnabled:    true,
+		DataCenterInfo: fargo.DataCenterInfo{Name: fargo.MyOwn},
+		Status:         status,
+	}
+}
+
+func TestResolver(t *testing.T) {
+	Convey("Given a Eureka server with instances registered for a VIP address", t, func() {
+		s := fargotest.NewServer()
+		defer s.Close()
+		up := testInstance("i-up", 9090, fargo.UP)
+		up.SetMetadataString("zone", "us-east-1a")
+		up.SetMetadataString("weight", "10")
+		s.Register(up)
+		s.Register(testInstance("i-down", 9091, fargo.DOWN))
+		e := s.Conn()
+		e.PollInterval = 50 * time.Millisecond
+		cc := newClientConn()
+
+		build := func(opts grpcresolver.Options, endpoint string) resolver.Resolver {
+			r, err := grpcresolver.NewBuilder(&e, opts).Build(resolver.Target{Scheme: grpcresolver.Scheme, Endpoint: endpoint}, cc, resolver.BuildOptions{})
+			So(err, ShouldBeNil)
+			return r
+		}
+		nextState := func() resolver.State {
+			select {
+			case s := <-cc.states:
+				return s
+			case err := <-cc.errs:
+				So(err, ShouldBeNil)
+			case <-time.After(5 * time.Second):
+				So("no state arrived", ShouldBeEmpty)
+			}
+			return resolver.State{}
+		}
+
+		Convey("a resolver offers the instances that are up", func() {
+			r := build(grpcresolver.Options{}, "testapp")
+			defer r.Close()
+			state := nextState()
+			So(state.Addresses, ShouldHaveLength, 1)
+			addr := state.Addresses[0]
+			So(addr.Addr, ShouldEqual, "127.0.0.1:9090")
+			So(addr.ServerName, ShouldEqual, "i-up")
+
+			Convey("with their IDs, metadata, and zones as balancer attributes", func() {
+				So(grpcresolver.InstanceID(addr), ShouldEqual, "i-up")
+				So(grpcresolver.Metadata(addr), ShouldResemble, map[string]string{"zone": "us-east-1a", "weight": "10"})
+				So(grpcresolver.Zone(addr), ShouldEqual, "us-east-1a")
+				So(addr.Attributes, ShouldBeNil)
+			})
+
+			Convey("which compare equal across updates", func() {
+				So(addr.BalancerAttributes.Equal(nextState().Addresses[0].BalancerAttributes), ShouldBeTrue)
+			})
+
+			Convey("and follows changes to the registered instances", func() {
+				s.Register(testInstance("i-up-too", 9092, fargo.UP))
+				for len(state.Addresses) < 2 {
+					state = nextState()
+				}
+				So(state.Addresses, ShouldHaveLength, 2)
+			})
+		})
+
+		Convey("a resolver can offer instances with other statuses", func() {
+			r := build(grpcresolver.Options{Statuses: []fargo.StatusType{fargo.UP, fargo.DOWN}}, "/testapp")
+			defer r.Close()
+			So(nextState().Addresses, ShouldHaveLength, 2)
+		})
+
+		Convey("a resolver reports a VIP address with no instances", func() {
+			r := build(grpcresolver.Options{}, "nonexistent")
+			defer r.Close()
+			select {
+			case err := <-cc.errs:
+				So(err, ShouldNotBeNil)
+			case <-time.After(5 * time.Second):
+				So("no error arrived", ShouldBeEmpty)
+			}
+		})
+
+		Convey("a target must name a VIP address", func() {
+			_, err := grpcresolver.NewBuilder(&e, grpcresolver.Options{}).Build(resolver.Target{Scheme: grpcresolver.Scheme}, cc, resolver.BuildOptions{})
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("A gRPC client reaches a server through a Eureka VIP address", t, func() {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		server := grpc.NewServer()
+		healthpb.RegisterHealthServer(server, health.NewServer())
+		go server.Serve(lis)
+		defer server.Stop()
+
+		s := fargotest.NewServer()
+		defer s.Close()
+		s.Register(testInstance("i-up", lis.Addr().(*net.TCPAddr).Port, fargo.UP))
+		e := s.Conn()
+		e.PollInterval = time.Minute
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		conn, err := grpc.DialContext(ctx, "eureka:///testapp",
+			grpc.WithInsecure(),
+			grpc.WithBlock(),
+			grpc.WithResolvers(grpcresolver.NewBuilder(&e, grpcresolver.Options{})))
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		So(err, ShouldBeNil)
+		So(resp.Status, ShouldEqual, healthpb.HealthCheckResponse_SERVING)
+	})
+}
@@ -0,0 +1,202 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Defaults for a HealthReporter, used when the corresponding HealthReporterOptions field is zero.
+const (
+	DefaultHealthCheckInterval  = 10 * time.Second
+	DefaultHealthCheckThreshold = 3
+)
+
+// A HealthCheck probes the health of the local instance, reporting the status it should have in
+// Eureka. Returning an error indicates that the instance is DOWN.
+type HealthCheck interface {
+	Check(ctx context.Context) (StatusType, error)
+}
+
+// HealthCheckFunc adapts an ordinary function to the HealthCheck interface.
+type HealthCheckFunc func(ctx context.Context) (StatusType, error)
+
+// Check calls f(ctx).
+func (f HealthCheckFunc) Check(ctx context.Context) (StatusType, error) {
+	return f(ctx)
+}
+
+// HTTPHealthCheck is a HealthCheck that probes an HTTP endpoint, such as an instance's
+// HealthCheckUrl.
+//
+// A response with a 2xx status code indicates that the instance is UP, and any other response
+// that it's DOWN, unless the response body is a JSON object with a "status" field naming another
+// status, as with {"status":"OUT_OF_SERVICE"}.
+type HTTPHealthCheck struct {
+	URL string
+	// Client sends the probes. If nil, http.DefaultClient is used.
+	Client Doer
+}
+
+// Check probes the endpoint.
+func (c *HTTPHealthCheck) Check(ctx context.Context) (StatusType, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.URL, nil)
+	if err != nil {
+		return DOWN, err
+	}
+	var client Doer = http.DefaultClient
+	if c.Client != nil {
+		client = c.Client
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return DOWN, err
+	}
+	defer resp.Body.Close()
+	status := DOWN
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		status = UP
+	}
+	var body struct {
+		Status StatusType `json:"status"`
+	}
+	if b, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10)); err == nil && json.Unmarshal(b, &body) == nil {
+		if len(body.Status) > 0 && isKnownStatus(body.Status) {
+			status = body.Status
+		}
+	}
+	return status, nil
+}
+
+// HealthReporterOptions tailor how a HealthReporter probes the local instance.
+type HealthReporterOptions struct {
+	// Interval is how often to probe the instance. If zero, DefaultHealthCheckInterval applies.
+	Interval time.Duration
+	// Timeout bounds each probe. If zero, the interval bounds it.
+	Timeout time.Duration
+	// Threshold is how many consecutive probes must agree on a status other than the one last
+	// reported before the reporter reports it, damping flapping. If zero,
+	// DefaultHealthCheckThreshold applies.
+	Threshold int
+}
+
+// A HealthReporter periodically probes the health of the local instance, updating the instance's
+// status in Eureka when the probes show that its status has changed.
+type HealthReporter struct {
+	e         *EurekaConnection
+	ins       *Instance
+	check     HealthCheck
+	interval  time.Duration
+	timeout   time.Duration
+	threshold int
+	m         sync.RWMutex
+	reported  StatusType
+	candidate StatusType
+	streak    int
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// NewHealthReporter starts probing the health of the given instance with the given check,
+// updating the instance's status in Eureka only once the configured number of consecutive
+// probes agree on a status other than the one last reported. It takes the instance's Status
+// field as the status last reported.
+//
+// If updating the status fails, the reporter tries again after its next probe. It continues until
+// Stop is called or the supplied context is done.
+func (e *EurekaConnection) NewHealthReporter(ctx context.Context, ins *Instance, check HealthCheck, opts HealthReporterOptions) *HealthReporter {
+	r := &HealthReporter{
+		e:         e,
+		ins:       ins,
+		check:     check,
+		interval:  opts.Interval,
+		timeout:   opts.Timeout,
+		threshold: opts.Threshold,
+		reported:  ins.Status,
+		done:      make(chan struct{}),
+	}
+	if r.interval <= 0 {
+		r.interval = DefaultHealthCheckInterval
+	}
+	if r.timeout <= 0 {
+		r.timeout = r.interval
+	}
+	if r.threshold <= 0 {
+		r.threshold = DefaultHealthCheckThreshold
+	}
+	ctx, r.cancel = context.WithCancel(ctx)
+	go r.run(ctx)
+	return r
+}
+
+func (r *HealthReporter) run(ctx context.Context) {
+	defer close(r.done)
+	t := time.NewTicker(r.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			r.observe(ctx, r.probe(ctx))
+		}
+	}
+}
+
+func (r *HealthReporter) probe(ctx context.Context) StatusType {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	status, err := r.check.Check(ctx)
+	if err != nil {
+		log.Warningf("Health check failed for Instance=%s App=%s, error: %s", r.ins.Id(), r.ins.App, err.Error())
+		return DOWN
+	}
+	if len(status) == 0 {
+		return UP
+	}
+	return status
+}
+
+// observe notes the outcome of a probe, updating the instance's status in Eureka once enough
+// consecutive probes agree that it has changed.
+func (r *HealthReporter) observe(ctx context.Context, status StatusType) {
+	if status == r.candidate {
+		r.streak++
+	} else {
+		r.candidate = status
+		r.streak = 1
+	}
+	r.m.RLock()
+	reported := r.reported
+	r.m.RUnlock()
+	if status == reported || r.streak < r.threshold {
+		return
+	}
+	log.Noticef("Instance=%s App=%s is now %s, was %s", r.ins.Id(), r.ins.App, status, reported)
+	if err := r.e.UpdateInstanceStatusContext(ctx, r.ins, status); err != nil {
+		log.Errorf("Failed to report status %s for Instance=%s App=%s, error: %s", status, r.ins.Id(), r.ins.App, err.Error())
+		return
+	}
+	r.m.Lock()
+	r.reported = status
+	r.m.Unlock()
+}
+
+// Status returns the status the reporter last reported to Eureka for the instance.
+func (r *HealthReporter) Status() StatusType {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	return r.reported
+}
+
+// Stop stops probing the instance, waiting for any probe in progress to complete. It is safe to
+// call Stop more than once, and after the reporter's context is done.
+func (r *HealthReporter) Stop() {
+	r.cancel()
+	<-r.done
+}
@@ -0,0 +1,125 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHTTPHealthCheck(t *testing.T) {
+	var code int
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	check := &HTTPHealthCheck{URL: server.URL}
+	ctx := context.Background()
+
+	Convey("An HTTP health check", t, func() {
+		body = ""
+
+		Convey("reports UP for a successful response", func() {
+			code = http.StatusOK
+			status, err := check.Check(ctx)
+			So(err, ShouldBeNil)
+			So(status, ShouldEqual, UP)
+		})
+
+		Convey("reports DOWN for an unsuccessful response", func() {
+			code = http.StatusServiceUnavailable
+			status, err := check.Check(ctx)
+			So(err, ShouldBeNil)
+			So(status, ShouldEqual, DOWN)
+		})
+
+		Convey("honors a status in the response body", func() {
+			code = http.StatusServiceUnavailable
+			body = `{"status":"OUT_OF_SERVICE"}`
+			status, err := check.Check(ctx)
+			So(err, ShouldBeNil)
+			So(status, ShouldEqual, OUTOFSERVICE)
+		})
+
+		Convey("fails when the endpoint is unreachable", func() {
+			unreachable := &HTTPHealthCheck{URL: "http://127.0.0.1:0/health"}
+			_, err := unreachable.Check(ctx)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestHealthReporter(t *testing.T) {
+	var m sync.Mutex
+	var updates []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+		updates = append(updates, r.URL.Query().Get("value"))
+	}))
+	defer server.Close()
+	reported := func() []string {
+		m.Lock()
+		defer m.Unlock()
+		return append([]string(nil), updates...)
+	}
+
+	Convey("Given a health reporter for an instance that is UP", t, func() {
+		m.Lock()
+		updates = nil
+		m.Unlock()
+		e := NewConn(server.URL)
+		ins := &Instance{App: "TESTAPP", HostName: "i-123456", Status: UP}
+		ctx := context.Background()
+		r := &HealthReporter{e: &e, ins: ins, threshold: 3, reported: UP}
+
+		Convey("a few failed probes don't change its status", func() {
+			r.observe(ctx, DOWN)
+			r.observe(ctx, UP)
+			r.observe(ctx, DOWN)
+			r.observe(ctx, DOWN)
+			So(r.Status(), ShouldEqual, UP)
+			So(reported(), ShouldBeEmpty)
+		})
+
+		Convey("consecutive failed probes report it DOWN, once", func() {
+			for i := 0; i < 5; i++ {
+				r.observe(ctx, DOWN)
+			}
+			So(r.Status(), ShouldEqual, DOWN)
+			So(reported(), ShouldResemble, []string{"DOWN"})
+
+			Convey("and consecutive successful probes report it UP again", func() {
+				for i := 0; i < 3; i++ {
+					r.observe(ctx, UP)
+				}
+				So(r.Status(), ShouldEqual, UP)
+				So(reported(), ShouldResemble, []string{"DOWN", "UP"})
+			})
+		})
+
+		Convey("it probes periodically until stopped", func() {
+			check := HealthCheckFunc(func(ctx context.Context) (StatusType, error) {
+				return "", errors.New("unhealthy")
+			})
+			r := e.NewHealthReporter(ctx, ins, check, HealthReporterOptions{Interval: 5 * time.Millisecond, Threshold: 3})
+			deadline := time.Now().Add(5 * time.Second)
+			for r.Status() != DOWN && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			r.Stop()
+			r.Stop()
+			So(r.Status(), ShouldEqual, DOWN)
+			So(reported(), ShouldResemble, []string{"DOWN"})
+		})
+	})
+}
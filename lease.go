@@ -0,0 +1,175 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// DefaultRenewalInterval is how often a LeaseManager renews the lease of an instance whose
+// LeaseInfo doesn't specify a renewal interval, matching Eureka's default.
+const DefaultRenewalInterval = 30 * time.Second
+
+// LeaseStatus reports the health of an instance's lease with Eureka, as maintained by a
+// LeaseManager.
+type LeaseStatus struct {
+	// Healthy is true if the most recent attempt to renew the lease succeeded.
+	Healthy bool
+	// Err is the error from the most recent attempt to renew the lease, if it failed.
+	Err error
+	// ConsecutiveFailures counts the failed attempts to renew the lease since it was last renewed.
+	ConsecutiveFailures int
+	// LastRenewal is when the lease was last renewed, whether by heartbeat or by registering the
+	// instance again.
+	LastRenewal time.Time
+	// Reregistered is true if the lease was last renewed by registering the instance again after
+	// Eureka reported that it no longer knew the instance.
+	Reregistered bool
+}
+
+// A LeaseManager keeps an instance registered with Eureka, sending heartbeats to renew its lease,
+// registering it again should Eureka evict it, and deregistering it once stopped.
+type LeaseManager struct {
+	e        *EurekaConnection
+	ins      *Instance
+	interval time.Duration
+	health   chan LeaseStatus
+	cancel   context.CancelFunc
+	done     chan struct{}
+	err      error
+}
+
+// NewLeaseManager registers the given instance with Eureka and returns a LeaseManager that keeps
+// it registered, sending heartbeats at the interval given by the instance's
+// LeaseInfo.RenewalIntervalInSecs, or DefaultRenewalInterval if that is zero.
+//
+// When a heartbeat fails because Eureka no longer knows the instance, the manager registers the
+// instance again. When a heartbeat fails for any other reason, the manager tries again sooner than
+// it otherwise would, backing off exponentially toward the renewal interval.
+//
+// The manager deregisters the instance once either Stop is called or the supplied context is
+// done. It returns an error if the initial registration fails, in which case it manages nothing.
+//
+// Once registered, the manager works from its own copy of the instance, so it never modifies the
+// given Instance, which other goroutines may go on reading. Changes made to the Instance after
+// the manager starts don't reach the manager.
+func (e *EurekaConnection) NewLeaseManager(ctx context.Context, ins *Instance) (*LeaseManager, error) {
+	interval := time.Duration(ins.LeaseInfo.RenewalIntervalInSecs) * time.Second
+	if interval <= 0 {
+		interval = DefaultRenewalInterval
+	}
+	return e.newLeaseManager(ctx, ins, interval)
+}
+
+func (e *EurekaConnection) newLeaseManager(ctx context.Context, ins *Instance, interval time.Duration) (*LeaseManager, error) {
+	if err := e.RegisterInstanceContext(ctx, ins); err != nil {
+		return nil, err
+	}
+	own := *ins
+	own.Metadata = ins.Metadata.clone()
+	ctx, cancel := context.WithCancel(ctx)
+	m := &LeaseManager{
+		e:        e,
+		ins:      &own,
+		interval: interval,
+		health:   make(chan LeaseStatus, 1),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	m.report(LeaseStatus{Healthy: true, LastRenewal: time.Now()})
+	go m.run(ctx)
+	return m, nil
+}
+
+// report offers the given status on the health channel, replacing any status the consumer has
+// yet to receive.
+func (m *LeaseManager) report(status LeaseStatus) {
+	select {
+	case <-m.health:
+	default:
+	}
+	m.health <- status
+}
+
+func (m *LeaseManager) renew(ctx context.Context) (reregistered bool, err error) {
+	err = m.e.HeartBeatInstanceContext(ctx, m.ins)
+	if code, ok := HTTPResponseStatusCode(err); ok && code == http.StatusNotFound {
+		log.Warningf("Eureka no longer knows Instance=%s App=%s, registering it again", m.ins.Id(), m.ins.App)
+		return true, m.e.ReregisterInstanceContext(ctx, m.ins)
+	}
+	return false, err
+}
+
+func (m *LeaseManager) run(ctx context.Context) {
+	defer close(m.done)
+	defer close(m.health)
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = time.Second
+	if b.InitialInterval > m.interval {
+		b.InitialInterval = m.interval
+	}
+	b.MaxInterval = m.interval
+	b.MaxElapsedTime = 0
+	var status LeaseStatus
+	status.LastRenewal = time.Now()
+	wait := m.interval
+	for {
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			m.deregister()
+			return
+		case <-t.C:
+		}
+		reregistered, err := m.renew(ctx)
+		if ctx.Err() != nil {
+			m.deregister()
+			return
+		}
+		if err != nil {
+			status.Healthy = false
+			status.Err = err
+			status.ConsecutiveFailures++
+			wait = b.NextBackOff()
+			log.Errorf("Failed to renew lease for Instance=%s App=%s, trying again in %s, error: %s", m.ins.Id(), m.ins.App, wait, err.Error())
+		} else {
+			status = LeaseStatus{Healthy: true, LastRenewal: time.Now(), Reregistered: reregistered}
+			b.Reset()
+			wait = m.interval
+		}
+		m.report(status)
+	}
+}
+
+func (m *LeaseManager) deregister() {
+	// The manager's own context is done by now, so deregister with a fresh one, bounded instead by
+	// the connection's timeout.
+	m.err = m.e.DeregisterInstanceContext(context.Background(), m.ins)
+}
+
+// Health returns a channel that offers the latest status of the instance's lease, updated after
+// each attempt to renew it. A status not received before the next attempt is replaced by the
+// newer status. The channel is closed once the manager stops.
+func (m *LeaseManager) Health() <-chan LeaseStatus {
+	return m.health
+}
+
+// Done returns a channel that is closed once the manager has stopped and deregistered the
+// instance, whether due to a call to Stop or to its context being done.
+func (m *LeaseManager) Done() <-chan struct{} {
+	return m.done
+}
+
+// Stop stops renewing the instance's lease and deregisters it from Eureka, waiting for the
+// deregistration to complete and returning any error that occurred. It is safe to call Stop more
+// than once, and after the manager's context is done.
+func (m *LeaseManager) Stop() error {
+	m.cancel()
+	<-m.done
+	return m.err
+}
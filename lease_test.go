@@ -0,0 +1,159 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// leaseServer stands in for Eureka, tracking registrations, heartbeats, and deregistrations.
+type leaseServer struct {
+	sync.Mutex
+	registered     bool
+	instance       []byte
+	registrations  int
+	heartbeats     int
+	deregistered   int
+	failHeartbeats bool
+}
+
+func (s *leaseServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	switch r.Method {
+	case "GET":
+		if !s.registered {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(s.instance)
+	case "POST":
+		s.registered = true
+		s.instance, _ = io.ReadAll(r.Body)
+		s.registrations++
+		w.WriteHeader(http.StatusNoContent)
+	case "PUT":
+		s.heartbeats++
+		switch {
+		case s.failHeartbeats:
+			w.WriteHeader(http.StatusInternalServerError)
+		case !s.registered:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case "DELETE":
+		s.registered = false
+		s.deregistered++
+	}
+}
+
+func (s *leaseServer) counts() (registrations, heartbeats, deregistered int) {
+	s.Lock()
+	defer s.Unlock()
+	return s.registrations, s.heartbeats, s.deregistered
+}
+
+func TestLeaseManager(t *testing.T) {
+
+	Convey("Given a lease manager for a registered instance", t, func() {
+		eureka := &leaseServer{}
+		server := httptest.NewServer(eureka)
+		defer server.Close()
+		e := NewConn(server.URL)
+		ins := validInstance()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		m, err := e.newLeaseManager(ctx, ins, 10*time.Millisecond)
+		So(err, ShouldBeNil)
+		defer m.Stop()
+		awaitHealth := func(pred func(LeaseStatus) bool) LeaseStatus {
+			for status := range m.Health() {
+				if pred(status) {
+					return status
+				}
+			}
+			return LeaseStatus{}
+		}
+
+		Convey("it sends heartbeats", func() {
+			awaitHealth(func(s LeaseStatus) bool {
+				_, heartbeats, _ := eureka.counts()
+				return s.Healthy && heartbeats >= 3
+			})
+			registrations, _, _ := eureka.counts()
+			So(registrations, ShouldEqual, 1)
+		})
+
+		Convey("it registers the instance again once evicted", func() {
+			// Read the instance throughout, as a HealthReporter would, for the race detector to
+			// catch the manager writing to it.
+			stop := make(chan struct{})
+			read := make(chan struct{})
+			go func() {
+				defer close(read)
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+						_ = ins.Id() + string(ins.Status)
+						time.Sleep(time.Millisecond)
+					}
+				}
+			}()
+			eureka.Lock()
+			eureka.registered = false
+			eureka.Unlock()
+			status := awaitHealth(func(s LeaseStatus) bool { return s.Reregistered })
+			close(stop)
+			<-read
+			So(status.Healthy, ShouldBeTrue)
+			registrations, _, _ := eureka.counts()
+			So(registrations, ShouldEqual, 2)
+		})
+
+		Convey("it reports failed heartbeats", func() {
+			eureka.Lock()
+			eureka.failHeartbeats = true
+			eureka.Unlock()
+			status := awaitHealth(func(s LeaseStatus) bool { return !s.Healthy })
+			So(status.Err, ShouldNotBeNil)
+			So(status.ConsecutiveFailures, ShouldBeGreaterThan, 0)
+		})
+
+		Convey("it deregisters the instance when stopped", func() {
+			So(m.Stop(), ShouldBeNil)
+			So(m.Stop(), ShouldBeNil)
+			_, _, deregistered := eureka.counts()
+			So(deregistered, ShouldEqual, 1)
+			_, open := <-m.Health()
+			for open {
+				_, open = <-m.Health()
+			}
+		})
+
+		Convey("it deregisters the instance when its context is done", func() {
+			cancel()
+			<-m.Done()
+			_, _, deregistered := eureka.counts()
+			So(deregistered, ShouldEqual, 1)
+		})
+	})
+
+	Convey("A lease manager fails if it can't register the instance", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer server.Close()
+		e := NewConn(server.URL)
+		_, err := e.NewLeaseManager(context.Background(), validInstance())
+		So(err, ShouldNotBeNil)
+	})
+}
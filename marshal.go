@@ -3,6 +3,7 @@ package fargo
 // MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
 
 import (
+	"bytes"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
@@ -131,12 +132,17 @@ func (i *Instance) UnmarshalJSON(b []byte) error {
 		*instance
 		Port       inboundJSONFormatPort `json:"port"`
 		SecurePort inboundJSONFormatPort `json:"securePort"`
+		// Some Eureka versions spell the overridden status in camel case.
+		OverriddenStatus StatusType `json:"overriddenStatus"`
 	}{
 		instance: (*instance)(i),
 	}
 	if err := json.Unmarshal(b, &aux); err != nil {
 		return err
 	}
+	if len(i.Overriddenstatus) == 0 {
+		i.Overriddenstatus = aux.OverriddenStatus
+	}
 	resolvePort := func(port interface{}) (int, error) {
 		return intFromJSONNumberOrString(port, "port number")
 	}
@@ -202,12 +208,17 @@ func (i *Instance) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 		*instance
 		Port       xmlFormatPort `xml:"port"`
 		SecurePort xmlFormatPort `xml:"securePort"`
+		// Some Eureka versions spell the overridden status in camel case.
+		OverriddenStatus StatusType `xml:"overriddenStatus"`
 	}{
 		instance: (*instance)(i),
 	}
 	if err := d.DecodeElement(&aux, &start); err != nil {
 		return err
 	}
+	if len(i.Overriddenstatus) == 0 {
+		i.Overriddenstatus = aux.OverriddenStatus
+	}
 	i.Port = aux.Port.Number
 	i.PortEnabled = aux.Port.Enabled
 	i.SecurePort = aux.SecurePort.Number
@@ -259,12 +270,18 @@ func (i *InstanceMetadata) MarshalJSON() ([]byte, error) {
 
 // MarshalXML is a custom XML marshaler for InstanceMetadata.
 func (i InstanceMetadata) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if raw := bytes.TrimSpace(i.Raw); i.parsed == nil && len(raw) > 0 && raw[0] == '<' {
+		// Reproduce the metadata as received, not yet having parsed it.
+		return e.EncodeElement(struct {
+			Raw []byte `xml:",innerxml"`
+		}{i.Raw}, start)
+	}
 	tokens := []xml.Token{start}
 
 	if i.parsed != nil {
 		for key, value := range i.parsed {
 			t := startLocalName(key)
-			tokens = append(tokens, t, xml.CharData(value.(string)), xml.EndElement{Name: t.Name})
+			tokens = append(tokens, t, xml.CharData(jsonValueAsString(value)), xml.EndElement{Name: t.Name})
 		}
 	}
 	tokens = append(tokens, xml.EndElement{Name: start.Name})
@@ -3,8 +3,11 @@ package fargo
 // MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
 
 import (
+	"bytes"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
+	"sort"
 
 	x2j "github.com/clbanning/mxj/x2j-wrapper"
 )
@@ -22,14 +25,64 @@ func (a *Application) ParseAllMetadata() error {
 	return nil
 }
 
-// SetMetadataString for a given instance before register
+// SetMetadataString for a given instance before register. If the instance's existing metadata
+// can't be parsed, it logs the error and leaves the metadata untouched.
 func (ins *Instance) SetMetadataString(key, value string) {
-	if ins.Metadata.parsed == nil {
-		ins.Metadata.parsed = map[string]interface{}{}
+	if err := ins.Metadata.update(map[string]string{key: value}, nil); err != nil {
+		log.Errorf("Failed setting metadata key %s for Instance=%s, error: %s", key, ins.Id(), err.Error())
 	}
-	ins.Metadata.parsed[key] = value
 }
 
+// update sets and removes the given keys, re-encoding Raw to match so that the two never
+// disagree. If Raw can't be parsed, it returns the parse error without changing anything.
+func (im *InstanceMetadata) update(set map[string]string, remove []string) error {
+	if err := im.parse(); err != nil {
+		return err
+	}
+	for k, v := range set {
+		im.parsed[k] = v
+	}
+	for _, k := range remove {
+		delete(im.parsed, k)
+	}
+	if len(im.Raw) > 0 && im.Raw[0] == '{' {
+		im.Raw, _ = json.Marshal(im.parsed)
+	} else {
+		im.Raw = encodeMetadataXML(im.parsed)
+	}
+	im.parsedRaw = im.Raw
+	return nil
+}
+
+// clone returns a copy of the metadata that can be updated without disturbing the original.
+func (im *InstanceMetadata) clone() InstanceMetadata {
+	c := InstanceMetadata{Raw: im.Raw, parsedRaw: im.parsedRaw}
+	if im.parsed != nil {
+		c.parsed = make(map[string]interface{}, len(im.parsed))
+		for k, v := range im.parsed {
+			c.parsed[k] = v
+		}
+	}
+	return c
+}
+
+// encodeMetadataXML encodes the metadata as a sequence of XML elements, ordered by key.
+func encodeMetadataXML(parsed map[string]interface{}) []byte {
+	keys := make([]string, 0, len(parsed))
+	for k := range parsed {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	for _, k := range keys {
+		buf.WriteString("<" + k + ">")
+		xml.EscapeText(&buf, []byte(jsonValueAsString(parsed[k])))
+		buf.WriteString("</" + k + ">")
+	}
+	return buf.Bytes()
+}
+
+// parse parses Raw into the metadata map, unless the map already reflects Raw's content.
 func (im *InstanceMetadata) parse() error {
 	if len(im.Raw) == 0 {
 		if im.parsed == nil {
@@ -37,15 +90,20 @@ func (im *InstanceMetadata) parse() error {
 		}
 		return nil
 	}
+	if im.parsed != nil && bytes.Equal(im.Raw, im.parsedRaw) {
+		return nil
+	}
 	metadataLog.Debugf("InstanceMetadata.parse: %s", im.Raw)
 
 	if len(im.Raw) > 0 && im.Raw[0] == '{' {
 		// JSON
-		err := json.Unmarshal(im.Raw, &im.parsed)
+		var parsed map[string]interface{}
+		err := json.Unmarshal(im.Raw, &parsed)
 		if err != nil {
 			log.Errorf("Error unmarshalling: %s", err.Error())
 			return fmt.Errorf("error unmarshalling: %s", err.Error())
 		}
+		im.parsed = parsed
 	} else {
 		// XML: wrap in a BS xml tag so all metadata tags are pulled
 		fullDoc := append(append([]byte("<d>"), im.Raw...), []byte("</d>")...)
@@ -56,6 +114,7 @@ func (im *InstanceMetadata) parse() error {
 		}
 		im.parsed = parsedDoc["d"].(map[string]interface{})
 	}
+	im.parsedRaw = im.Raw
 	return nil
 }
 
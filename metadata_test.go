@@ -0,0 +1,97 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMetadataUpdates(t *testing.T) {
+	var m sync.Mutex
+	var requests []*http.Request
+	var registered Instance
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+		requests = append(requests, r)
+		switch r.Method {
+		case "GET":
+			// Decline to read back the registration, leaving the instance as registered.
+			w.WriteHeader(http.StatusNotFound)
+		case "POST":
+			body, _ := io.ReadAll(r.Body)
+			registered = Instance{}
+			if err := xml.Unmarshal(body, &registered); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	Convey("Given an instance with metadata", t, func() {
+		m.Lock()
+		requests = nil
+		m.Unlock()
+		e := NewConn(server.URL)
+		ins := validInstance()
+		ins.Metadata.Raw = []byte("<a>one</a><b>two</b>")
+
+		Convey("updating several keys sends a single request", func() {
+			err := e.UpdateMetadata(ins, map[string]string{"b": "deux", "c": "trois"})
+			So(err, ShouldBeNil)
+			So(requests, ShouldHaveLength, 1)
+			So(requests[0].Method, ShouldEqual, "PUT")
+			So(requests[0].URL.Path, ShouldEqual, "/apps/TESTAPP/i-123456/metadata")
+			So(requests[0].URL.Query(), ShouldResemble, url.Values{"b": {"deux"}, "c": {"trois"}})
+
+			Convey("and the instance reflects the update", func() {
+				So(ins.Metadata.GetMap(), ShouldResemble, map[string]interface{}{"a": "one", "b": "deux", "c": "trois"})
+				So(string(ins.Metadata.Raw), ShouldEqual, "<a>one</a><b>deux</b><c>trois</c>")
+			})
+		})
+
+		Convey("removing a key registers the instance again without it", func() {
+			err := e.RemoveMetadata(ins, "a")
+			So(err, ShouldBeNil)
+			So(requests[0].Method, ShouldEqual, "POST")
+			v, err := registered.Metadata.GetString("b")
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, "two")
+			So(registered.Metadata.GetMap(), ShouldNotContainKey, "a")
+
+			Convey("and the instance reflects the removal", func() {
+				So(ins.Metadata.GetMap(), ShouldResemble, map[string]interface{}{"b": "two"})
+				So(string(ins.Metadata.Raw), ShouldEqual, "<b>two</b>")
+			})
+		})
+
+		Convey("a failed removal leaves the instance's metadata intact", func() {
+			ins.DataCenterInfo.Name = ""
+			err := e.RemoveMetadata(ins, "a")
+			So(err, ShouldNotBeNil)
+			So(string(ins.Metadata.Raw), ShouldEqual, "<a>one</a><b>two</b>")
+			v, err := ins.Metadata.GetString("a")
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, "one")
+		})
+
+		Convey("metadata that can't be parsed is neither updated nor wiped", func() {
+			ins.Metadata.Raw = []byte(`{"a": "one"`)
+			ins.SetMetadataString("b", "two")
+			So(e.UpdateMetadata(ins, map[string]string{"b": "two"}), ShouldNotBeNil)
+			So(e.RemoveMetadata(ins, "a"), ShouldNotBeNil)
+			So(requests, ShouldBeEmpty)
+			So(string(ins.Metadata.Raw), ShouldEqual, `{"a": "one"`)
+		})
+	})
+}
@@ -3,19 +3,23 @@ package fargo
 // MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
 
 import (
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
 )
 
-func (e *EurekaConnection) generateURL(slugs ...string) string {
-	return strings.Join(append([]string{e.SelectServiceURL()}, slugs...), "/")
+// generatePath joins the given slugs into a path relative to a Eureka service URL. Each request
+// resolves that path against whichever service URLs it tries in turn.
+func generatePath(slugs ...string) string {
+	return strings.Join(slugs, "/")
 }
 
 func (e *EurekaConnection) marshal(v interface{}) ([]byte, error) {
@@ -42,10 +46,16 @@ func (e *EurekaConnection) marshal(v interface{}) ([]byte, error) {
 
 // GetApp returns a single eureka application by name
 func (e *EurekaConnection) GetApp(name string) (*Application, error) {
+	return e.GetAppContext(context.Background(), name)
+}
+
+// GetAppContext returns a single eureka application by name, abandoning the request if the
+// supplied context is done before it completes.
+func (e *EurekaConnection) GetAppContext(ctx context.Context, name string) (*Application, error) {
 	slug := fmt.Sprintf("%s/%s", EurekaURLSlugs["Apps"], name)
-	reqURL := e.generateURL(slug)
-	log.Debugf("Getting app %s from url %s", name, reqURL)
-	out, rcode, err := getBody(reqURL, e.UseJson)
+	reqPath := generatePath(slug)
+	log.Debugf("Getting app %s from path %s", name, reqPath)
+	out, rcode, err := e.getBody(ctx, reqPath, e.UseJson)
 	if err != nil {
 		log.Errorf("Couldn't get app %s, error: %s", name, err.Error())
 		return nil, err
@@ -85,16 +95,54 @@ func (e *EurekaConnection) readAppInto(app *Application) error {
 
 // GetApps returns a map of all Applications
 func (e *EurekaConnection) GetApps() (map[string]*Application, error) {
+	return e.GetAppsContext(context.Background())
+}
+
+// GetAppsContext returns a map of all Applications, abandoning the request if the supplied context
+// is done before it completes.
+func (e *EurekaConnection) GetAppsContext(ctx context.Context) (map[string]*Application, error) {
 	slug := EurekaURLSlugs["Apps"]
-	reqURL := e.generateURL(slug)
-	log.Debugf("Getting all apps from url %s", reqURL)
-	body, rcode, err := getBody(reqURL, e.UseJson)
+	reqPath := generatePath(slug)
+	log.Debugf("Getting all apps from path %s", reqPath)
+	r, err := e.getApps(ctx, reqPath)
 	if err != nil {
 		log.Errorf("Couldn't get apps, error: %s", err.Error())
 		return nil, err
 	}
+	return appsByName(r), nil
+}
+
+// GetAppsDelta returns the changes made to the registry within Eureka's recent change window,
+// with each instance's ActionType indicating whether it was added, modified, or deleted. The
+// response's AppsHashcode summarizes the full registry once the changes are applied.
+func (e *EurekaConnection) GetAppsDelta() (*GetAppsResponse, error) {
+	return e.GetAppsDeltaContext(context.Background())
+}
+
+// GetAppsDeltaContext behaves like GetAppsDelta, but abandons the request if the supplied context
+// is done before it completes.
+func (e *EurekaConnection) GetAppsDeltaContext(ctx context.Context) (*GetAppsResponse, error) {
+	reqPath := generatePath(EurekaURLSlugs["Apps"], "delta")
+	log.Debugf("Getting apps delta from path %s", reqPath)
+	r, err := e.getApps(ctx, reqPath)
+	if err != nil {
+		log.Errorf("Couldn't get apps delta, error: %s", err.Error())
+		return nil, err
+	}
+	for _, app := range r.Applications {
+		app.ParseAllMetadata()
+	}
+	return r, nil
+}
+
+func (e *EurekaConnection) getApps(ctx context.Context, reqPath string) (*GetAppsResponse, error) {
+	body, rcode, err := e.getBody(ctx, reqPath, e.UseJson)
+	if err != nil {
+		return nil, err
+	}
 	if rcode > 299 || rcode < 200 {
 		log.Warningf("Non-200 rcode of %d", rcode)
+		return nil, &unsuccessfulHTTPResponse{rcode, "unable to retrieve applications"}
 	}
 
 	var r *GetAppsResponse
@@ -109,7 +157,13 @@ func (e *EurekaConnection) GetApps() (map[string]*Application, error) {
 		log.Errorf("Unmarshalling error: %s", err.Error())
 		return nil, err
 	}
+	if r == nil {
+		r = &GetAppsResponse{}
+	}
+	return r, nil
+}
 
+func appsByName(r *GetAppsResponse) map[string]*Application {
 	apps := map[string]*Application{}
 	for i, a := range r.Applications {
 		apps[a.Name] = r.Applications[i]
@@ -118,7 +172,7 @@ func (e *EurekaConnection) GetApps() (map[string]*Application, error) {
 		log.Debugf("Parsing metadata for app %s", name)
 		app.ParseAllMetadata()
 	}
-	return apps, nil
+	return apps
 }
 
 func instanceCount(apps []*Application) int {
@@ -315,16 +369,24 @@ func filterInstancesInApps(apps []*Application, pred func(*Instance) bool) []*In
 	}
 }
 
-func (e *EurekaConnection) getInstancesByVIPAddress(addr string, secure bool, opts instanceQueryOptions) ([]*Instance, error) {
+func (e *EurekaConnection) getInstancesByVIPAddress(ctx context.Context, addr string, secure bool, opts instanceQueryOptions) ([]*Instance, error) {
+	apps, err := e.getAppsByVIPAddress(ctx, addr, secure)
+	if err != nil {
+		return nil, err
+	}
+	return selectInstances(apps, opts), nil
+}
+
+func (e *EurekaConnection) getAppsByVIPAddress(ctx context.Context, addr string, secure bool) ([]*Application, error) {
 	var slug string
 	if secure {
 		slug = EurekaURLSlugs["InstancesBySecureVIPAddress"]
 	} else {
 		slug = EurekaURLSlugs["InstancesByVIPAddress"]
 	}
-	reqURL := e.generateURL(slug, addr)
-	log.Debugf("Getting instances for VIP address %q from URL %s", addr, reqURL)
-	body, rcode, err := getBody(reqURL, e.UseJson)
+	reqPath := generatePath(slug, addr)
+	log.Debugf("Getting instances for VIP address %q from path %s", addr, reqPath)
+	body, rcode, err := e.getBody(ctx, reqPath, e.UseJson)
 	if err != nil {
 		return nil, err
 	}
@@ -343,18 +405,24 @@ func (e *EurekaConnection) getInstancesByVIPAddress(addr string, secure bool, op
 		log.Errorf("Unmarshalling error: %s", err.Error())
 		return nil, err
 	}
+	return r.Applications, nil
+}
+
+// selectInstances collects the instances from the given applications, filtering and ordering them
+// per the given options.
+func selectInstances(apps []*Application, opts instanceQueryOptions) []*Instance {
 	var instances []*Instance
 	if pred := opts.predicate; pred != nil {
-		instances = filterInstancesInApps(r.Applications, pred)
+		instances = filterInstancesInApps(apps, pred)
 	} else {
-		switch len(r.Applications) {
+		switch len(apps) {
 		case 0:
 		case 1:
-			instances = r.Applications[0].Instances
+			instances = apps[0].Instances
 		default:
-			instances = make([]*Instance, instanceCount(r.Applications))
+			instances = make([]*Instance, instanceCount(apps))
 			base := 0
-			for _, app := range r.Applications {
+			for _, app := range apps {
 				base += copy(instances[base:], app.Instances)
 			}
 		}
@@ -362,7 +430,7 @@ func (e *EurekaConnection) getInstancesByVIPAddress(addr string, secure bool, op
 	if intn := opts.intn; intn != nil {
 		shuffleInstances(instances, intn)
 	}
-	return instances, nil
+	return instances
 }
 
 func mergeInstanceQueryOptions(defaults instanceQueryOptions, opts []InstanceQueryOption) (instanceQueryOptions, error) {
@@ -386,11 +454,17 @@ func collectInstanceQueryOptions(opts []InstanceQueryOption) (instanceQueryOptio
 //
 // NB: The VIP address is case-sensitive, and must match the address used at registration time.
 func (e *EurekaConnection) GetInstancesByVIPAddress(addr string, secure bool, opts ...InstanceQueryOption) ([]*Instance, error) {
+	return e.GetInstancesByVIPAddressContext(context.Background(), addr, secure, opts...)
+}
+
+// GetInstancesByVIPAddressContext behaves like GetInstancesByVIPAddress, but abandons the request
+// if the supplied context is done before it completes.
+func (e *EurekaConnection) GetInstancesByVIPAddressContext(ctx context.Context, addr string, secure bool, opts ...InstanceQueryOption) ([]*Instance, error) {
 	options, err := collectInstanceQueryOptions(opts)
 	if err != nil {
 		return nil, err
 	}
-	return e.getInstancesByVIPAddress(addr, secure, options)
+	return e.getInstancesByVIPAddress(ctx, addr, secure, options)
 }
 
 // InstanceSetUpdate is the outcome of an attempt to get a fresh snapshot of a Eureka VIP address's
@@ -437,7 +511,7 @@ func scheduleInstanceUpdates(d time.Duration, produce func() ([]*Instance, error
 
 func (e *EurekaConnection) scheduleVIPAddressUpdates(addr string, secure bool, await bool, done <-chan struct{}, opts instanceQueryOptions) <-chan InstanceSetUpdate {
 	produce := func() ([]*Instance, error) {
-		return e.getInstancesByVIPAddress(addr, secure, opts)
+		return e.getInstancesByVIPAddress(context.Background(), addr, secure, opts)
 	}
 	return scheduleInstanceUpdates(e.PollInterval, produce, await, done)
 }
@@ -467,26 +541,26 @@ func (e *EurekaConnection) makeInstanceProducerForApp(name string, opts []Instan
 	if err != nil {
 		return nil, err
 	}
-	predicate := options.predicate
-	intn := options.intn
+	fetch := e.makeAppFetcher(name)
 	return func() ([]*Instance, error) {
-		app, err := e.GetApp(name)
+		apps, err := fetch()
 		if err != nil {
 			return nil, err
 		}
-		instances := app.Instances
-		if instances != nil {
-			if predicate != nil {
-				instances = filterInstances(instances, predicate)
-			}
-			if intn != nil {
-				shuffleInstances(instances, intn)
-			}
-		}
-		return instances, nil
+		return selectInstances(apps, options), nil
 	}, nil
 }
 
+func (e *EurekaConnection) makeAppFetcher(name string) func() ([]*Application, error) {
+	return func() ([]*Application, error) {
+		app, err := e.GetApp(name)
+		if err != nil {
+			return nil, err
+		}
+		return []*Application{app}, nil
+	}
+}
+
 // ScheduleAppInstanceUpdates starts polling for updates to the set of instances from the Eureka
 // application with the given name, potentially filtered per the constraints supplied as options,
 // using the connection's configured polling interval as its period. It sends the outcome of each
@@ -510,50 +584,72 @@ func (e *EurekaConnection) ScheduleAppInstanceUpdates(name string, await bool, d
 type InstanceSetSource struct {
 	m         sync.RWMutex
 	instances []*Instance
+	freshness freshness
 	done      chan<- struct{}
 }
 
-func (e *EurekaConnection) newInstanceSetSourceFor(produce func() ([]*Instance, error), await bool) *InstanceSetSource {
+// NB: If an application contained no instances, such that it either lacked the "instance" field
+// entirely or had it present but with a "null" value, or none of the present instances satisfied
+// the filtering predicate, then it's possible that the slice returned by selectInstances will be
+// nil. Make it possible to discern when we've received at least one update in Latest by never
+// storing a nil value for a successful update.
+func nonNilInstances(instances []*Instance) []*Instance {
+	if instances != nil {
+		return instances
+	}
+	return []*Instance{}
+}
+
+func (s *InstanceSetSource) update(instances []*Instance, err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.freshness.record(err) {
+		return
+	}
+	if err == nil {
+		s.instances = nonNilInstances(instances)
+	} else {
+		s.instances = nil
+	}
+}
+
+// newInstanceSetSourceFor creates an InstanceSetSource selecting instances per the given options
+// from the applications produced by fetch. If snapshot names a file, the source persists each
+// successful fetch there, and starts out with the instances from any such file already present.
+func (e *EurekaConnection) newInstanceSetSourceFor(fetch func() ([]*Application, error), opts instanceQueryOptions, snapshot string, await bool) *InstanceSetSource {
 	done := make(chan struct{})
 	s := &InstanceSetSource{
-		done: done,
+		freshness: freshness{retainFor: e.RetainStaleFor},
+		done:      done,
 	}
-	// NB: If an application contained no instances, such that it either lacked the "instance" field
-	// entirely or had it present but with a "null" value, or none of the present instances
-	// satisfied the filtering predicate, then it's possible that the slice returned by
-	// getInstancesByVIPAddress (or similar) will be nil. Make it possible to discern when we've
-	// received at least one update in Latest by never storing a nil value for a successful update.
-	if await {
-		if instances, err := produce(); err == nil {
-			if instances != nil {
-				s.instances = instances
-			} else {
-				s.instances = []*Instance{}
-			}
-		}
+	if apps, ok := e.loadSnapshot(snapshot); ok {
+		s.instances = nonNilInstances(selectInstances(apps, opts))
+		s.freshness.seeded()
 	}
-	consume := func(instances []*Instance, err error) {
-		var latest []*Instance
-		if err == nil {
-			if instances != nil {
-				latest = instances
-			} else {
-				latest = []*Instance{}
-			}
+	produce := func() ([]*Instance, error) {
+		apps, err := fetch()
+		if err != nil {
+			return nil, err
 		}
-		s.m.Lock()
-		s.instances = latest
-		s.m.Unlock()
+		e.saveSnapshot(snapshot, apps)
+		return selectInstances(apps, opts), nil
+	}
+	if await {
+		s.update(produce())
 	}
-	go exchangeInstancesEvery(e.PollInterval, produce, consume, done)
+	go exchangeInstancesEvery(e.PollInterval, produce, s.update, done)
 	return s
 }
 
 func (e *EurekaConnection) newInstanceSetSourceForVIPAddress(addr string, secure bool, await bool, opts instanceQueryOptions) *InstanceSetSource {
-	produce := func() ([]*Instance, error) {
-		return e.getInstancesByVIPAddress(addr, secure, opts)
+	fetch := func() ([]*Application, error) {
+		return e.getAppsByVIPAddress(context.Background(), addr, secure)
+	}
+	kind := "vip"
+	if secure {
+		kind = "svip"
 	}
-	return e.newInstanceSetSourceFor(produce, await)
+	return e.newInstanceSetSourceFor(fetch, opts, e.snapshotPath(kind, addr), await)
 }
 
 // NewInstanceSetSourceForVIPAddress returns a new InstantSetSource that offers a periodically
@@ -587,11 +683,11 @@ func (e *EurekaConnection) NewInstanceSetSourceForVIPAddress(addr string, secure
 // It returns an error if any of the supplied options are invalid, precluding it from scheduling the
 // intended updates.
 func (e *EurekaConnection) NewInstanceSetSourceForApp(name string, await bool, opts ...InstanceQueryOption) (*InstanceSetSource, error) {
-	produce, err := e.makeInstanceProducerForApp(name, opts)
+	options, err := collectInstanceQueryOptions(opts)
 	if err != nil {
 		return nil, err
 	}
-	return e.newInstanceSetSourceFor(produce, await), nil
+	return e.newInstanceSetSourceFor(e.makeAppFetcher(name), options, e.snapshotPath("app", name), await), nil
 }
 
 // Latest returns the most recently acquired set of Eureka instances, if any. If the most recent
@@ -599,6 +695,12 @@ func (e *EurekaConnection) NewInstanceSetSourceForApp(name string, await bool, o
 //
 // Note that if the most recent update attempt was successful but resulted in no instances, it
 // returns a non-nil empty slice.
+//
+// If the connection has a positive RetainStaleFor, the source retains its latest set of instances
+// despite failed update attempts until that long after its last successful update. If the
+// connection has a SnapshotDir, a source starts out with the instances from its last persisted
+// snapshot, if any, and retains them despite failed update attempts until an update succeeds.
+// IsStale reports whether the instances returned are retained in either of these ways.
 func (s *InstanceSetSource) Latest() []*Instance {
 	if s == nil {
 		return nil
@@ -608,6 +710,40 @@ func (s *InstanceSetSource) Latest() []*Instance {
 	return s.instances
 }
 
+// IsStale returns true if the source's latest set of instances is retained despite the most
+// recent update attempt having failed, or came from a persisted snapshot rather than from
+// Eureka, with no update having yet succeeded.
+func (s *InstanceSetSource) IsStale() bool {
+	if s == nil {
+		return false
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.freshness.stale
+}
+
+// LastError returns the error from the source's most recent update attempt, or nil if that
+// attempt succeeded or no attempt has yet to complete.
+func (s *InstanceSetSource) LastError() error {
+	if s == nil {
+		return nil
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.freshness.lastErr
+}
+
+// LastSuccess returns the time at which the source last updated its set of instances
+// successfully, or the zero time if no update has yet succeeded.
+func (s *InstanceSetSource) LastSuccess() time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.freshness.lastSuccess
+}
+
 // Stop turns off an InstantSetSource, so that it will no longer attempt to update its latest set of
 // Eureka instances.
 //
@@ -628,12 +764,23 @@ func (s *InstanceSetSource) Stop() {
 
 // RegisterInstance will register the given Instance with eureka if it is not already registered,
 // but DOES NOT automatically send heartbeats. See HeartBeatInstance for that
-// functionality
+// functionality. It returns an *InvalidInstanceError without contacting Eureka if the instance
+// fails validation; see Instance.Validate.
 func (e *EurekaConnection) RegisterInstance(ins *Instance) error {
+	return e.RegisterInstanceContext(context.Background(), ins)
+}
+
+// RegisterInstanceContext behaves like RegisterInstance, but abandons the registration if the
+// supplied context is done before it completes.
+func (e *EurekaConnection) RegisterInstanceContext(ctx context.Context, ins *Instance) error {
+	if err := ins.Validate(); err != nil {
+		log.Errorf("Refusing to register Instance=%s App=%s, error: %s", ins.Id(), ins.App, err.Error())
+		return err
+	}
 	slug := fmt.Sprintf("%s/%s", EurekaURLSlugs["Apps"], ins.App)
-	reqURL := e.generateURL(slug)
-	log.Debugf("Registering instance with url %s", reqURL)
-	_, rcode, err := getBody(reqURL+"/"+ins.Id(), e.UseJson)
+	reqPath := generatePath(slug)
+	log.Debugf("Registering instance with path %s", reqPath)
+	_, rcode, err := e.getBody(ctx, reqPath+"/"+ins.Id(), e.UseJson)
 	if err != nil {
 		log.Errorf("Failed check if Instance=%s exists in app=%s, error: %s",
 			ins.Id(), ins.App, err.Error())
@@ -644,15 +791,25 @@ func (e *EurekaConnection) RegisterInstance(ins *Instance) error {
 		return nil
 	}
 	log.Noticef("Instance=%s not yet registered with App=%s, registering.", ins.Id(), ins.App)
-	return e.ReregisterInstance(ins)
+	return e.ReregisterInstanceContext(ctx, ins)
 }
 
 // ReregisterInstance will register the given Instance with eureka but DOES
 // NOT automatically send heartbeats. See HeartBeatInstance for that
-// functionality
+// functionality. Like RegisterInstance, it validates the instance first.
 func (e *EurekaConnection) ReregisterInstance(ins *Instance) error {
+	return e.ReregisterInstanceContext(context.Background(), ins)
+}
+
+// ReregisterInstanceContext behaves like ReregisterInstance, but abandons the registration if the
+// supplied context is done before it completes.
+func (e *EurekaConnection) ReregisterInstanceContext(ctx context.Context, ins *Instance) error {
+	if err := ins.Validate(); err != nil {
+		log.Errorf("Refusing to register Instance=%s App=%s, error: %s", ins.Id(), ins.App, err.Error())
+		return err
+	}
 	slug := fmt.Sprintf("%s/%s", EurekaURLSlugs["Apps"], ins.App)
-	reqURL := e.generateURL(slug)
+	reqPath := generatePath(slug)
 
 	var out []byte
 	var err error
@@ -665,7 +822,7 @@ func (e *EurekaConnection) ReregisterInstance(ins *Instance) error {
 		return err
 	}
 
-	body, rcode, err := postBody(reqURL, out, e.UseJson)
+	body, rcode, err := e.postBody(ctx, reqPath, out, e.UseJson)
 	if err != nil {
 		log.Errorf("Could not complete registration, error: %s", err.Error())
 		return err
@@ -677,17 +834,23 @@ func (e *EurekaConnection) ReregisterInstance(ins *Instance) error {
 	}
 
 	// read back our registration to pick up eureka-supplied values
-	e.readInstanceInto(ins)
+	e.readInstanceInto(ctx, ins)
 
 	return nil
 }
 
 // GetInstance gets an Instance from eureka given its app and instanceid.
 func (e *EurekaConnection) GetInstance(app, insId string) (*Instance, error) {
+	return e.GetInstanceContext(context.Background(), app, insId)
+}
+
+// GetInstanceContext gets an Instance from eureka given its app and instanceid, abandoning the
+// request if the supplied context is done before it completes.
+func (e *EurekaConnection) GetInstanceContext(ctx context.Context, app, insId string) (*Instance, error) {
 	slug := fmt.Sprintf("%s/%s/%s", EurekaURLSlugs["Apps"], app, insId)
-	reqURL := e.generateURL(slug)
-	log.Debugf("Getting instance with url %s", reqURL)
-	body, rcode, err := getBody(reqURL, e.UseJson)
+	reqPath := generatePath(slug)
+	log.Debugf("Getting instance with path %s", reqPath)
+	body, rcode, err := e.getBody(ctx, reqPath, e.UseJson)
 	if err != nil {
 		return nil, err
 	}
@@ -705,8 +868,8 @@ func (e *EurekaConnection) GetInstance(app, insId string) (*Instance, error) {
 	return ins, err
 }
 
-func (e *EurekaConnection) readInstanceInto(ins *Instance) error {
-	tins, err := e.GetInstance(ins.App, ins.Id())
+func (e *EurekaConnection) readInstanceInto(ctx context.Context, ins *Instance) error {
+	tins, err := e.GetInstanceContext(ctx, ins.App, ins.Id())
 	if err == nil {
 		tins.UniqueID = ins.UniqueID
 		*ins = *tins
@@ -717,11 +880,17 @@ func (e *EurekaConnection) readInstanceInto(ins *Instance) error {
 // DeregisterInstance will deregister the given Instance from eureka. This is good practice
 // to do before exiting or otherwise going off line.
 func (e *EurekaConnection) DeregisterInstance(ins *Instance) error {
+	return e.DeregisterInstanceContext(context.Background(), ins)
+}
+
+// DeregisterInstanceContext behaves like DeregisterInstance, but abandons the deregistration if
+// the supplied context is done before it completes.
+func (e *EurekaConnection) DeregisterInstanceContext(ctx context.Context, ins *Instance) error {
 	slug := fmt.Sprintf("%s/%s/%s", EurekaURLSlugs["Apps"], ins.App, ins.Id())
-	reqURL := e.generateURL(slug)
-	log.Debugf("Deregistering instance with url %s", reqURL)
+	reqPath := generatePath(slug)
+	log.Debugf("Deregistering instance with path %s", reqPath)
 
-	rcode, err := deleteReq(reqURL)
+	rcode, err := e.deleteReq(ctx, reqPath, nil)
 	if err != nil {
 		log.Errorf("Could not complete deregistration, error: %s", err.Error())
 		return err
@@ -738,13 +907,37 @@ func (e *EurekaConnection) DeregisterInstance(ins *Instance) error {
 
 // AddMetadataString to a given instance. Is immediately sent to Eureka server.
 func (e EurekaConnection) AddMetadataString(ins *Instance, key, value string) error {
-	slug := fmt.Sprintf("%s/%s/%s/metadata", EurekaURLSlugs["Apps"], ins.App, ins.Id())
-	reqURL := e.generateURL(slug)
+	return e.AddMetadataStringContext(context.Background(), ins, key, value)
+}
 
-	params := map[string]string{key: value}
+// AddMetadataStringContext behaves like AddMetadataString, but abandons the update if the supplied
+// context is done before it completes.
+func (e EurekaConnection) AddMetadataStringContext(ctx context.Context, ins *Instance, key, value string) error {
+	return e.UpdateMetadataContext(ctx, ins, map[string]string{key: value})
+}
 
-	log.Debugf("Updating instance metadata url=%s metadata=%s", reqURL, params)
-	body, rcode, err := putKV(reqURL, params)
+// UpdateMetadata adds the given metadata to a given instance, replacing the values of any keys
+// already present, in a single request to the Eureka server. Once the server accepts the update,
+// it is reflected in the instance's Metadata field.
+func (e EurekaConnection) UpdateMetadata(ins *Instance, metadata map[string]string) error {
+	return e.UpdateMetadataContext(context.Background(), ins, metadata)
+}
+
+// UpdateMetadataContext behaves like UpdateMetadata, but abandons the update if the supplied
+// context is done before it completes.
+func (e EurekaConnection) UpdateMetadataContext(ctx context.Context, ins *Instance, metadata map[string]string) error {
+	if len(metadata) == 0 {
+		return nil
+	}
+	// Check that the instance's metadata can be updated locally before updating it on the server.
+	if err := ins.Metadata.parse(); err != nil {
+		return err
+	}
+	slug := fmt.Sprintf("%s/%s/%s/metadata", EurekaURLSlugs["Apps"], ins.App, ins.Id())
+	reqPath := generatePath(slug)
+
+	log.Debugf("Updating instance metadata path=%s metadata=%s", reqPath, metadata)
+	body, rcode, err := e.putKV(ctx, reqPath, metadata)
 	if err != nil {
 		log.Errorf("Could not complete update, error: %s", err.Error())
 		return err
@@ -754,19 +947,54 @@ func (e EurekaConnection) AddMetadataString(ins *Instance, key, value string) er
 			ins.Id(), ins.App, string(body))
 		return &unsuccessfulHTTPResponse{rcode, "possible failure updating instance metadata"}
 	}
-	ins.SetMetadataString(key, value)
+	return ins.Metadata.update(metadata, nil)
+}
+
+// RemoveMetadata removes the given metadata keys from a given instance. Eureka offers no way to
+// remove metadata directly, so RemoveMetadata registers the instance again without those keys,
+// which also resets the instance's status and lease to those given in the Instance. Once the
+// server accepts the registration, it updates the Instance as ReregisterInstance does, leaving it
+// untouched should the registration fail.
+func (e EurekaConnection) RemoveMetadata(ins *Instance, keys ...string) error {
+	return e.RemoveMetadataContext(context.Background(), ins, keys...)
+}
+
+// RemoveMetadataContext behaves like RemoveMetadata, but abandons the removal if the supplied
+// context is done before it completes.
+func (e EurekaConnection) RemoveMetadataContext(ctx context.Context, ins *Instance, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	stripped := *ins
+	stripped.Metadata = ins.Metadata.clone()
+	if err := stripped.Metadata.update(nil, keys); err != nil {
+		return err
+	}
+	log.Debugf("Removing metadata keys=%v from Instance=%s App=%s", keys, ins.Id(), ins.App)
+	if err := e.ReregisterInstanceContext(ctx, &stripped); err != nil {
+		return err
+	}
+	*ins = stripped
 	return nil
 }
 
-// UpdateInstanceStatus updates the status of a given instance with eureka.
+// UpdateInstanceStatus updates the status of a given instance with eureka. Eureka records the
+// status as an override, taking precedence over the status the instance itself reports until
+// removed with RemoveStatusOverride.
 func (e EurekaConnection) UpdateInstanceStatus(ins *Instance, status StatusType) error {
+	return e.UpdateInstanceStatusContext(context.Background(), ins, status)
+}
+
+// UpdateInstanceStatusContext behaves like UpdateInstanceStatus, but abandons the update if the
+// supplied context is done before it completes.
+func (e EurekaConnection) UpdateInstanceStatusContext(ctx context.Context, ins *Instance, status StatusType) error {
 	slug := fmt.Sprintf("%s/%s/%s/status", EurekaURLSlugs["Apps"], ins.App, ins.Id())
-	reqURL := e.generateURL(slug)
+	reqPath := generatePath(slug)
 
 	params := map[string]string{"value": string(status)}
 
-	log.Debugf("Updating instance status url=%s value=%s", reqURL, status)
-	body, rcode, err := putKV(reqURL, params)
+	log.Debugf("Updating instance status path=%s value=%s", reqPath, status)
+	body, rcode, err := e.putKV(ctx, reqPath, params)
 	if err != nil {
 		log.Error("Could not complete update, error: ", err.Error())
 		return err
@@ -779,18 +1007,51 @@ func (e EurekaConnection) UpdateInstanceStatus(ins *Instance, status StatusType)
 	return nil
 }
 
+// RemoveStatusOverride removes the status override that UpdateInstanceStatus placed on a given
+// instance with eureka, restoring the instance's control over its own status. If fallback is not
+// empty, eureka sets the instance's status to it in the meantime; otherwise eureka considers the
+// instance's status UNKNOWN until the instance next registers or renews its lease.
+func (e EurekaConnection) RemoveStatusOverride(ins *Instance, fallback StatusType) error {
+	return e.RemoveStatusOverrideContext(context.Background(), ins, fallback)
+}
+
+// RemoveStatusOverrideContext behaves like RemoveStatusOverride, but abandons the removal if the
+// supplied context is done before it completes.
+func (e EurekaConnection) RemoveStatusOverrideContext(ctx context.Context, ins *Instance, fallback StatusType) error {
+	slug := fmt.Sprintf("%s/%s/%s/status", EurekaURLSlugs["Apps"], ins.App, ins.Id())
+	reqPath := generatePath(slug)
+
+	var params url.Values
+	if len(fallback) > 0 {
+		params = url.Values{"value": {string(fallback)}}
+	}
+
+	log.Debugf("Removing instance status override path=%s fallback=%s", reqPath, fallback)
+	rcode, err := e.deleteReq(ctx, reqPath, params)
+	if err != nil {
+		log.Error("Could not complete status override removal, error: ", err.Error())
+		return err
+	}
+	if rcode < 200 || rcode >= 300 {
+		log.Warningf("HTTP returned %d removing status override Instance=%s App=%s", rcode, ins.Id(), ins.App)
+		return &unsuccessfulHTTPResponse{rcode, "possible failure removing instance status override"}
+	}
+	return nil
+}
+
 // HeartBeatInstance sends a single eureka heartbeat. Does not continue sending
 // heartbeats. Errors if the response is not 200.
 func (e *EurekaConnection) HeartBeatInstance(ins *Instance) error {
+	return e.HeartBeatInstanceContext(context.Background(), ins)
+}
+
+// HeartBeatInstanceContext behaves like HeartBeatInstance, but abandons the heartbeat if the
+// supplied context is done before it completes.
+func (e *EurekaConnection) HeartBeatInstanceContext(ctx context.Context, ins *Instance) error {
 	slug := fmt.Sprintf("%s/%s/%s", EurekaURLSlugs["Apps"], ins.App, ins.Id())
-	reqURL := e.generateURL(slug)
-	log.Debugf("Sending heartbeat with url %s", reqURL)
-	req, err := http.NewRequest("PUT", reqURL, nil)
-	if err != nil {
-		log.Errorf("Could not create request for heartbeat, error: %s", err.Error())
-		return err
-	}
-	_, rcode, err := netReq(req)
+	reqPath := generatePath(slug)
+	log.Debugf("Sending heartbeat with path %s", reqPath)
+	_, rcode, err := e.putKV(ctx, reqPath, nil)
 	if err != nil {
 		log.Errorf("Error sending heartbeat for Instance=%s App=%s, error: %s", ins.Id(), ins.App, err.Error())
 		return err
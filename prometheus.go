@@ -0,0 +1,206 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Labels that a Prometheus service discovery handler attaches to each target. Prometheus offers
+// labels beginning with "__meta_" for relabeling, then discards them. The names match those of
+// Prometheus's own Eureka service discovery where the two overlap.
+const (
+	PrometheusLabelAppName          = "__meta_eureka_app_name"
+	PrometheusLabelInstanceID       = "__meta_eureka_app_instance_id"
+	PrometheusLabelHostName         = "__meta_eureka_app_instance_hostname"
+	PrometheusLabelVIPAddress       = "__meta_eureka_app_instance_vip_address"
+	PrometheusLabelSecureVIPAddress = "__meta_eureka_app_instance_secure_vip_address"
+	PrometheusLabelStatus           = "__meta_eureka_app_instance_status"
+	PrometheusLabelZone             = "__meta_eureka_app_instance_zone"
+	// PrometheusLabelMetadataPrefix precedes each instance metadata key, with any characters not
+	// allowed in a Prometheus label name replaced by underscores.
+	PrometheusLabelMetadataPrefix = "__meta_eureka_app_instance_metadata_"
+)
+
+// PrometheusSDOptions restricts which instances a Prometheus service discovery handler offers as
+// targets. The zero value offers every instance with an enabled port.
+//
+// Requests may restrict the targets further with "app" and "status" query parameters, each of
+// which may appear several times, as in "?app=billing&app=audit&status=UP".
+type PrometheusSDOptions struct {
+	// Apps lists the names of the applications whose instances to offer, ignoring case. If empty,
+	// the handler offers instances from every application.
+	Apps []string
+	// Statuses lists the statuses of the instances to offer. If empty, the handler offers
+	// instances with any status.
+	Statuses []StatusType
+}
+
+// PrometheusTargetGroup is an element of the JSON array expected by Prometheus's HTTP service
+// discovery.
+type PrometheusTargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+type prometheusSDHandler struct {
+	getApps  func(ctx context.Context) (map[string]*Application, error)
+	apps     map[string]bool
+	statuses map[StatusType]bool
+}
+
+// NewPrometheusSDHandler returns an http.Handler that serves the instances registered with
+// Eureka in the format that Prometheus's HTTP service discovery expects, fetching the full
+// registry from Eureka for each request. Each instance becomes a target addressed by its IPAddr
+// and its Port, or its SecurePort if only that is enabled, labeled with its application, VIP
+// addresses, status, availability zone, and metadata.
+//
+// To avoid a request to Eureka per scrape of the handler, use the PrometheusSDHandler method of a
+// Registry instead.
+func (e *EurekaConnection) NewPrometheusSDHandler(opts PrometheusSDOptions) http.Handler {
+	return newPrometheusSDHandler(e.GetAppsContext, opts)
+}
+
+// PrometheusSDHandler returns an http.Handler that serves the instances in the registry in the
+// format that Prometheus's HTTP service discovery expects, as described for
+// EurekaConnection.NewPrometheusSDHandler. It responds with status 503 until the registry's first
+// update succeeds.
+func (r *Registry) PrometheusSDHandler(opts PrometheusSDOptions) http.Handler {
+	return newPrometheusSDHandler(func(context.Context) (map[string]*Application, error) {
+		return r.GetApps()
+	}, opts)
+}
+
+func newPrometheusSDHandler(getApps func(context.Context) (map[string]*Application, error), opts PrometheusSDOptions) *prometheusSDHandler {
+	h := &prometheusSDHandler{getApps: getApps}
+	if len(opts.Apps) > 0 {
+		h.apps = make(map[string]bool, len(opts.Apps))
+		for _, name := range opts.Apps {
+			h.apps[strings.ToUpper(name)] = true
+		}
+	}
+	if len(opts.Statuses) > 0 {
+		h.statuses = make(map[StatusType]bool, len(opts.Statuses))
+		for _, s := range opts.Statuses {
+			h.statuses[s] = true
+		}
+	}
+	return h
+}
+
+func (h *prometheusSDHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	apps, err := h.getApps(r.Context())
+	if err != nil {
+		log.Errorf("Failed to get applications for Prometheus service discovery: %s", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	query := r.URL.Query()
+	wantApps := upperSet(query["app"])
+	wantStatuses := upperSet(query["status"])
+
+	groups := []PrometheusTargetGroup{}
+	for _, app := range sortedApps(apps) {
+		name := strings.ToUpper(app.Name)
+		if (h.apps != nil && !h.apps[name]) || (wantApps != nil && !wantApps[name]) {
+			continue
+		}
+		for _, ins := range app.Instances {
+			if (h.statuses != nil && !h.statuses[ins.Status]) || (wantStatuses != nil && !wantStatuses[strings.ToUpper(string(ins.Status))]) {
+				continue
+			}
+			if g, ok := prometheusTargetGroup(app.Name, ins); ok {
+				groups = append(groups, g)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(groups); err != nil {
+		log.Warningf("Failed to write Prometheus service discovery response: %s", err)
+	}
+}
+
+func upperSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[strings.ToUpper(v)] = true
+	}
+	return set
+}
+
+func sortedApps(apps map[string]*Application) []*Application {
+	sorted := make([]*Application, 0, len(apps))
+	for _, app := range apps {
+		sorted = append(sorted, app)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// prometheusTargetGroup describes the given instance as a Prometheus target, unless it has no
+// enabled port to scrape.
+func prometheusTargetGroup(appName string, ins *Instance) (PrometheusTargetGroup, bool) {
+	var port int
+	switch {
+	case ins.PortEnabled:
+		port = ins.Port
+	case ins.SecurePortEnabled:
+		port = ins.SecurePort
+	}
+	if port <= 0 {
+		return PrometheusTargetGroup{}, false
+	}
+	host := ins.IPAddr
+	if host == "" {
+		host = ins.HostName
+	}
+	labels := make(map[string]string)
+	metadata := metadataOf(ins)
+	for k, v := range metadata {
+		// Prometheus treats a label with an empty value as absent, as suits nested values.
+		labels[PrometheusLabelMetadataPrefix+sanitizeLabelName(k)] = jsonValueAsString(v)
+	}
+	labels[PrometheusLabelAppName] = appName
+	labels[PrometheusLabelInstanceID] = ins.Id()
+	labels[PrometheusLabelHostName] = ins.HostName
+	labels[PrometheusLabelVIPAddress] = ins.VipAddress
+	labels[PrometheusLabelSecureVIPAddress] = ins.SecureVipAddress
+	labels[PrometheusLabelStatus] = string(ins.Status)
+	zone := ins.DataCenterInfo.Metadata.AvailabilityZone
+	if zone == "" {
+		zone = jsonValueAsString(metadata["zone"])
+	}
+	labels[PrometheusLabelZone] = zone
+	return PrometheusTargetGroup{
+		Targets: []string{net.JoinHostPort(host, strconv.Itoa(port))},
+		Labels:  labels,
+	}, true
+}
+
+// sanitizeLabelName replaces each character not allowed in a Prometheus label name with an
+// underscore.
+func sanitizeLabelName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
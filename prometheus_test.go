@@ -0,0 +1,129 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const prometheusAppsXML = `<applications>
+  <application>
+    <name>TESTAPP</name>
+    <instance><hostName>i-1</hostName><app>TESTAPP</app><ipAddr>10.0.0.1</ipAddr><vipAddress>testapp</vipAddress><secureVipAddress>testapp-secure</secureVipAddress><status>UP</status><port enabled="true">8080</port><dataCenterInfo><name>MyOwn</name></dataCenterInfo><metadata><zone>us-east-1a</zone><metrics.path>/metrics</metrics.path></metadata></instance>
+    <instance><hostName>i-2</hostName><app>TESTAPP</app><ipAddr>10.0.0.2</ipAddr><vipAddress>testapp</vipAddress><status>DOWN</status><port enabled="true">8080</port><dataCenterInfo><name>MyOwn</name></dataCenterInfo></instance>
+    <instance><hostName>i-3</hostName><app>TESTAPP</app><ipAddr>10.0.0.3</ipAddr><vipAddress>testapp</vipAddress><status>UP</status><securePort enabled="true">8443</securePort><dataCenterInfo><name>MyOwn</name></dataCenterInfo></instance>
+  </application>
+  <application>
+    <name>OTHERAPP</name>
+    <instance><hostName>i-4</hostName><app>OTHERAPP</app><ipAddr>10.0.0.4</ipAddr><vipAddress>otherapp</vipAddress><status>UP</status><port enabled="true">9090</port><dataCenterInfo><name>MyOwn</name></dataCenterInfo></instance>
+    <instance><hostName>i-5</hostName><app>OTHERAPP</app><ipAddr>10.0.0.5</ipAddr><vipAddress>otherapp</vipAddress><status>UP</status><port enabled="false">9090</port><dataCenterInfo><name>MyOwn</name></dataCenterInfo></instance>
+  </application>
+</applications>`
+
+func TestPrometheusSDHandler(t *testing.T) {
+	available := true
+	eureka := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(prometheusAppsXML))
+	}))
+	defer eureka.Close()
+
+	serve := func(h http.Handler, target string) (int, []PrometheusTargetGroup) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		var groups []PrometheusTargetGroup
+		if rec.Code == http.StatusOK {
+			So(rec.Header().Get("Content-Type"), ShouldEqual, "application/json")
+			So(json.Unmarshal(rec.Body.Bytes(), &groups), ShouldBeNil)
+		}
+		return rec.Code, groups
+	}
+	targets := func(groups []PrometheusTargetGroup) []string {
+		var targets []string
+		for _, g := range groups {
+			targets = append(targets, g.Targets...)
+		}
+		return targets
+	}
+
+	Convey("Given a handler fetching the registry from Eureka", t, func() {
+		available = true
+		e := NewConn(eureka.URL)
+
+		Convey("every instance with an enabled port becomes a target", func() {
+			code, groups := serve(e.NewPrometheusSDHandler(PrometheusSDOptions{}), "/sd")
+			So(code, ShouldEqual, http.StatusOK)
+			So(targets(groups), ShouldResemble, []string{"10.0.0.4:9090", "10.0.0.1:8080", "10.0.0.2:8080", "10.0.0.3:8443"})
+
+			Convey("labeled with the instance's details and metadata", func() {
+				labels := groups[1].Labels
+				So(labels[PrometheusLabelAppName], ShouldEqual, "TESTAPP")
+				So(labels[PrometheusLabelInstanceID], ShouldEqual, "i-1")
+				So(labels[PrometheusLabelHostName], ShouldEqual, "i-1")
+				So(labels[PrometheusLabelVIPAddress], ShouldEqual, "testapp")
+				So(labels[PrometheusLabelSecureVIPAddress], ShouldEqual, "testapp-secure")
+				So(labels[PrometheusLabelStatus], ShouldEqual, "UP")
+				So(labels[PrometheusLabelZone], ShouldEqual, "us-east-1a")
+				So(labels[PrometheusLabelMetadataPrefix+"metrics_path"], ShouldEqual, "/metrics")
+			})
+		})
+
+		Convey("the handler's options restrict the targets", func() {
+			h := e.NewPrometheusSDHandler(PrometheusSDOptions{Apps: []string{"testapp"}, Statuses: []StatusType{UP}})
+			_, groups := serve(h, "/sd")
+			So(targets(groups), ShouldResemble, []string{"10.0.0.1:8080", "10.0.0.3:8443"})
+		})
+
+		Convey("query parameters restrict the targets", func() {
+			h := e.NewPrometheusSDHandler(PrometheusSDOptions{})
+			_, groups := serve(h, "/sd?app=TESTAPP&status=down")
+			So(targets(groups), ShouldResemble, []string{"10.0.0.2:8080"})
+			_, groups = serve(h, "/sd?app=testapp&app=otherapp&status=UP")
+			So(targets(groups), ShouldResemble, []string{"10.0.0.4:9090", "10.0.0.1:8080", "10.0.0.3:8443"})
+		})
+
+		Convey("no matching instances yields an empty list", func() {
+			code, groups := serve(e.NewPrometheusSDHandler(PrometheusSDOptions{}), "/sd?app=nonexistent")
+			So(code, ShouldEqual, http.StatusOK)
+			So(groups, ShouldNotBeNil)
+			So(groups, ShouldBeEmpty)
+		})
+
+		Convey("a failure to reach Eureka is reported as unavailability", func() {
+			available = false
+			code, _ := serve(e.NewPrometheusSDHandler(PrometheusSDOptions{}), "/sd")
+			So(code, ShouldEqual, http.StatusServiceUnavailable)
+		})
+	})
+
+	Convey("Given a handler serving a cached registry", t, func() {
+		available = true
+		e := NewConn(eureka.URL)
+		e.PollInterval = time.Hour
+		r := e.NewRegistry(true)
+		defer r.Stop()
+		h := r.PrometheusSDHandler(PrometheusSDOptions{Statuses: []StatusType{UP}})
+
+		Convey("the registry's instances become targets", func() {
+			code, groups := serve(h, "/sd")
+			So(code, ShouldEqual, http.StatusOK)
+			So(targets(groups), ShouldResemble, []string{"10.0.0.4:9090", "10.0.0.1:8080", "10.0.0.3:8443"})
+
+			Convey("without further requests to Eureka", func() {
+				available = false
+				code, groups := serve(h, "/sd")
+				So(code, ShouldEqual, http.StatusOK)
+				So(groups, ShouldHaveLength, 3)
+			})
+		})
+	})
+}
@@ -0,0 +1,268 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type instanceKey struct {
+	app string
+	id  string
+}
+
+// registryIndex is an immutable snapshot of the registry, indexed for the queries a Registry
+// answers.
+type registryIndex struct {
+	apps        map[string]*Application
+	byApp       map[string]*Application
+	byVIP       map[string][]*Instance
+	bySecureVIP map[string][]*Instance
+	byID        map[instanceKey]*Instance
+}
+
+// vipAddresses splits a VIP address, which may list several addresses separated by commas.
+func vipAddresses(addr string) []string {
+	if len(addr) == 0 {
+		return nil
+	}
+	addrs := strings.Split(addr, ",")
+	for i, a := range addrs {
+		addrs[i] = strings.TrimSpace(a)
+	}
+	return addrs
+}
+
+func newRegistryIndex(apps map[string]*Application) *registryIndex {
+	idx := &registryIndex{
+		apps:        apps,
+		byApp:       make(map[string]*Application, len(apps)),
+		byVIP:       make(map[string][]*Instance),
+		bySecureVIP: make(map[string][]*Instance),
+		byID:        make(map[instanceKey]*Instance),
+	}
+	names := make([]string, 0, len(apps))
+	for name := range apps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		app := apps[name]
+		appKey := strings.ToUpper(name)
+		idx.byApp[appKey] = app
+		for _, ins := range app.Instances {
+			for _, addr := range vipAddresses(ins.VipAddress) {
+				idx.byVIP[addr] = append(idx.byVIP[addr], ins)
+			}
+			for _, addr := range vipAddresses(ins.SecureVipAddress) {
+				idx.bySecureVIP[addr] = append(idx.bySecureVIP[addr], ins)
+			}
+			idx.byID[instanceKey{appKey, ins.Id()}] = ins
+		}
+	}
+	return idx
+}
+
+// A Registry holds a periodically updated copy of the full Eureka registry, answering queries about
+// applications and instances locally rather than sending requests to Eureka.
+//
+// A Registry fetches the registry through a RegistryClient, and so fetches only the changes
+// since its last fetch when its connection has EnableDelta set.
+//
+// If its connection has a SnapshotDir, a Registry starts out with the registry from its last
+// persisted snapshot, if any, until its first update succeeds.
+type Registry struct {
+	e        *EurekaConnection
+	client   *RegistryClient
+	snapshot string
+	m        sync.RWMutex
+	index    *registryIndex
+	stale    bool
+	done     chan<- struct{}
+}
+
+// NewRegistry returns a new Registry that holds a periodically updated copy of the full Eureka
+// registry, using the connection's configured polling interval as its period.
+//
+// If await is true, it waits for the first registry update to complete before returning, though
+// it's possible that that first update attempt could fail, so that subsequent queries would
+// return ErrRegistryUnavailable until a later update succeeds.
+func (e *EurekaConnection) NewRegistry(await bool) *Registry {
+	done := make(chan struct{})
+	r := &Registry{
+		e:        e,
+		client:   e.NewRegistryClient(),
+		snapshot: e.snapshotPath("registry"),
+		done:     done,
+	}
+	if apps, ok := e.loadSnapshot(r.snapshot); ok {
+		r.index = newRegistryIndex(appsByName(&GetAppsResponse{Applications: apps}))
+		r.stale = true
+	}
+	if await {
+		r.Refresh(context.Background())
+	}
+	go func() {
+		t := time.NewTicker(e.PollInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				r.Refresh(context.Background())
+			}
+		}
+	}()
+	return r
+}
+
+// Refresh updates the registry immediately, rather than waiting for its next scheduled update. If
+// the update fails, the registry retains its previous copy.
+func (r *Registry) Refresh(ctx context.Context) error {
+	if err := r.client.Refresh(ctx); err != nil {
+		log.Errorf("Failure updating registry, error: %s", err.Error())
+		return err
+	}
+	idx := newRegistryIndex(r.client.Apps())
+	r.m.Lock()
+	r.index = idx
+	r.stale = false
+	r.m.Unlock()
+	if len(r.snapshot) > 0 {
+		apps := make([]*Application, 0, len(idx.apps))
+		for _, app := range idx.byApp {
+			apps = append(apps, app)
+		}
+		sort.Slice(apps, func(i, j int) bool {
+			return apps[i].Name < apps[j].Name
+		})
+		r.e.saveSnapshot(r.snapshot, apps)
+	}
+	return nil
+}
+
+// IsStale returns true if the registry's copy came from a persisted snapshot rather than from
+// Eureka, with no update having yet succeeded.
+func (r *Registry) IsStale() bool {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	return r.stale
+}
+
+func (r *Registry) latest() (*registryIndex, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	if r.index == nil {
+		return nil, ErrRegistryUnavailable
+	}
+	return r.index, nil
+}
+
+// GetApps returns all the applications in the registry, keyed by name. Callers must not modify
+// the applications returned.
+func (r *Registry) GetApps() (map[string]*Application, error) {
+	idx, err := r.latest()
+	if err != nil {
+		return nil, err
+	}
+	return idx.apps, nil
+}
+
+// GetApp returns the application in the registry with the given name, ignoring case. If the
+// registry contains no such application, it returns an AppNotFoundError. Callers must not modify
+// the application returned.
+func (r *Registry) GetApp(name string) (*Application, error) {
+	idx, err := r.latest()
+	if err != nil {
+		return nil, err
+	}
+	app, ok := idx.byApp[strings.ToUpper(name)]
+	if !ok {
+		return nil, AppNotFoundError{specific: name}
+	}
+	return app, nil
+}
+
+// GetInstance returns the instance in the registry with the given ID from the application with
+// the given name. If the registry contains no such instance, it returns an InstanceNotFoundError.
+func (r *Registry) GetInstance(app, insId string) (*Instance, error) {
+	idx, err := r.latest()
+	if err != nil {
+		return nil, err
+	}
+	ins, ok := idx.byID[instanceKey{strings.ToUpper(app), insId}]
+	if !ok {
+		return nil, InstanceNotFoundError{app: app, id: insId}
+	}
+	return ins, nil
+}
+
+// queryInstances filters and orders the given instances per the given options, copying them
+// first if the options call for reordering them in place.
+func queryInstances(instances []*Instance, opts []InstanceQueryOption) ([]*Instance, error) {
+	options, err := collectInstanceQueryOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if pred := options.predicate; pred != nil {
+		instances = filterInstances(instances, pred)
+	}
+	if intn := options.intn; intn != nil && len(instances) > 1 {
+		instances = append([]*Instance(nil), instances...)
+		shuffleInstances(instances, intn)
+	}
+	return instances, nil
+}
+
+// GetInstancesByApp returns the set of instances in the registry from the application with the
+// given name, ignoring case, potentially filtered per the constraints supplied as options. If the
+// registry contains no such application, it returns an AppNotFoundError.
+func (r *Registry) GetInstancesByApp(name string, opts ...InstanceQueryOption) ([]*Instance, error) {
+	app, err := r.GetApp(name)
+	if err != nil {
+		return nil, err
+	}
+	return queryInstances(app.Instances, opts)
+}
+
+// GetInstancesByVIPAddress returns the set of instances in the registry with the given VIP
+// address, selecting either an insecure or secure VIP address with the given name, potentially
+// filtered per the constraints supplied as options. An instance registered with several VIP
+// addresses separated by commas is found by each of them.
+//
+// NB: The VIP address is case-sensitive, and must match the address used at registration time.
+func (r *Registry) GetInstancesByVIPAddress(addr string, secure bool, opts ...InstanceQueryOption) ([]*Instance, error) {
+	idx, err := r.latest()
+	if err != nil {
+		return nil, err
+	}
+	var instances []*Instance
+	if secure {
+		instances = idx.bySecureVIP[addr]
+	} else {
+		instances = idx.byVIP[addr]
+	}
+	return queryInstances(instances, opts)
+}
+
+// Stop turns off a Registry, so that it will no longer attempt to update its copy of the registry.
+//
+// It is safe to query a stopped registry, which continues to answer with its last copy.
+func (r *Registry) Stop() {
+	if r == nil {
+		return
+	}
+	// Allow multiple calls to Stop by precluding repeated attempts to close an already closed
+	// channel.
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.done != nil {
+		close(r.done)
+		r.done = nil
+	}
+}
@@ -0,0 +1,140 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const registryXML = `<applications>
+  <versions__delta>1</versions__delta>
+  <apps__hashcode>DOWN_1_UP_3_</apps__hashcode>
+  <application>
+    <name>WEB</name>
+    <instance><hostName>web-1</hostName><app>WEB</app><vipAddress>web</vipAddress><secureVipAddress>web-secure</secureVipAddress><status>UP</status></instance>
+    <instance><hostName>web-2</hostName><app>WEB</app><vipAddress>web,frontend</vipAddress><status>DOWN</status></instance>
+  </application>
+  <application>
+    <name>API</name>
+    <instance><hostName>api-1</hostName><app>API</app><vipAddress>api, frontend</vipAddress><status>UP</status></instance>
+    <instance><hostName>api-2</hostName><app>API</app><vipAddress>api</vipAddress><status>UP</status></instance>
+  </application>
+</applications>`
+
+func TestRegistry(t *testing.T) {
+	var hits int
+	available := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if !available {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, registryXML)
+	}))
+	defer server.Close()
+
+	hostNames := func(instances []*Instance) []string {
+		names := make([]string, len(instances))
+		for i, ins := range instances {
+			names[i] = ins.HostName
+		}
+		return names
+	}
+
+	Convey("Given a registry that has yet to fetch from Eureka", t, func() {
+		available = false
+		e := NewConn(server.URL)
+		e.PollInterval = time.Hour
+		r := e.NewRegistry(true)
+		defer r.Stop()
+
+		Convey("queries fail", func() {
+			_, err := r.GetApps()
+			So(err, ShouldEqual, ErrRegistryUnavailable)
+			_, err = r.GetInstancesByVIPAddress("web", false)
+			So(err, ShouldEqual, ErrRegistryUnavailable)
+		})
+	})
+
+	Convey("Given a registry populated from Eureka", t, func() {
+		available = true
+		e := NewConn(server.URL)
+		e.PollInterval = time.Hour
+		r := e.NewRegistry(true)
+		defer r.Stop()
+		hits = 0
+
+		Convey("it finds applications by name", func() {
+			apps, err := r.GetApps()
+			So(err, ShouldBeNil)
+			So(apps, ShouldHaveLength, 2)
+			app, err := r.GetApp("web")
+			So(err, ShouldBeNil)
+			So(app.Name, ShouldEqual, "WEB")
+			_, err = r.GetApp("MISSING")
+			So(err, ShouldHaveSameTypeAs, AppNotFoundError{})
+		})
+
+		Convey("it finds instances by application", func() {
+			instances, err := r.GetInstancesByApp("WEB", ThatAreUp)
+			So(err, ShouldBeNil)
+			So(hostNames(instances), ShouldResemble, []string{"web-1"})
+		})
+
+		Convey("it finds instances by ID", func() {
+			ins, err := r.GetInstance("API", "api-2")
+			So(err, ShouldBeNil)
+			So(ins.HostName, ShouldEqual, "api-2")
+			_, err = r.GetInstance("WEB", "api-2")
+			So(err, ShouldHaveSameTypeAs, InstanceNotFoundError{})
+		})
+
+		Convey("it finds instances by VIP address", func() {
+			instances, err := r.GetInstancesByVIPAddress("frontend", false)
+			So(err, ShouldBeNil)
+			So(hostNames(instances), ShouldResemble, []string{"api-1", "web-2"})
+			instances, err = r.GetInstancesByVIPAddress("frontend", false, ThatAreUp)
+			So(err, ShouldBeNil)
+			So(hostNames(instances), ShouldResemble, []string{"api-1"})
+			instances, err = r.GetInstancesByVIPAddress("web-secure", true)
+			So(err, ShouldBeNil)
+			So(hostNames(instances), ShouldResemble, []string{"web-1"})
+			instances, err = r.GetInstancesByVIPAddress("web-secure", false)
+			So(err, ShouldBeNil)
+			So(instances, ShouldBeEmpty)
+		})
+
+		Convey("shuffling results leaves the registry's order intact", func() {
+			for i := 0; i < 10; i++ {
+				_, err := r.GetInstancesByVIPAddress("api", false, ShuffledWith(rand.New(rand.NewSource(int64(i)))))
+				So(err, ShouldBeNil)
+			}
+			instances, err := r.GetInstancesByVIPAddress("api", false)
+			So(err, ShouldBeNil)
+			So(hostNames(instances), ShouldResemble, []string{"api-1", "api-2"})
+		})
+
+		Convey("queries don't reach Eureka", func() {
+			r.GetApps()
+			r.GetInstancesByVIPAddress("web", false)
+			So(hits, ShouldEqual, 0)
+		})
+
+		Convey("it retains its copy when an update fails", func() {
+			available = false
+			So(r.Refresh(context.Background()), ShouldNotBeNil)
+			apps, err := r.GetApps()
+			So(err, ShouldBeNil)
+			So(apps, ShouldHaveLength, 2)
+		})
+	})
+}
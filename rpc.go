@@ -4,6 +4,7 @@ package fargo
 
 import (
 	"bytes"
+	"context"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -11,83 +12,143 @@ import (
 	"time"
 )
 
+// Doer sends HTTP requests, as *http.Client does. A EurekaConnection uses a Doer to talk to its
+// Eureka servers.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// HttpClient is the client used by any EurekaConnection that lacks its own HTTPClient.
 var HttpClient = &http.Client{
 	Transport: transport,
 	Timeout:   30 * time.Second,
 }
 
 var transport = &http.Transport{
-	Dial: (&net.Dialer{
-		Timeout: 5 * time.Second,
-	}).Dial,
+	DialContext:           dialContext,
 	ResponseHeaderTimeout: 10 * time.Second,
 }
 
-func postBody(reqURL string, reqBody []byte, isJson bool) ([]byte, int, error) {
-	req, err := http.NewRequest("POST", reqURL, bytes.NewReader(reqBody))
-	if err != nil {
-		log.Errorf("Could not create POST %s with body %s, error: %s", reqURL, string(reqBody), err.Error())
-		return nil, -1, err
+// defaultConnectTimeout bounds establishing a connection for a EurekaConnection without its own
+// ConnectTimeout.
+const defaultConnectTimeout = 5 * time.Second
+
+type connectTimeoutKey struct{}
+
+// dialContext establishes connections for the package's HTTP clients, giving up after the
+// ConnectTimeout of the EurekaConnection that sent the request, as carried by its context.
+func dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	d := net.Dialer{Timeout: defaultConnectTimeout}
+	if t, ok := ctx.Value(connectTimeoutKey{}).(time.Duration); ok && t > 0 {
+		d.Timeout = t
 	}
-	log.Debugf("postBody: %s %s : %s\n", req.Method, req.URL, string(reqBody))
-	body, rcode, err := netReqTyped(req, isJson)
-	if err != nil {
-		log.Errorf("Could not complete POST %s with body %s, error: %s", reqURL, string(reqBody), err.Error())
-		return nil, rcode, err
+	return d.DialContext(ctx, network, addr)
+}
+
+// httpClient returns the connection's own HTTP client if it has one, a client honoring its TLS
+// settings if it has those, or the shared HttpClient otherwise. It fails if the TLS settings can't
+// be loaded.
+func (e *EurekaConnection) httpClient() (Doer, error) {
+	if e.HTTPClient != nil {
+		return e.HTTPClient, nil
+	}
+	if e.TLS != nil {
+		client, err := e.TLS.currentClient()
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
 	}
-	//eurekaCache.Flush()
-	return body, rcode, nil
+	return HttpClient, nil
 }
 
-func putKV(reqURL string, pairs map[string]string) ([]byte, int, error) {
+func (e *EurekaConnection) postBody(ctx context.Context, slug string, reqBody []byte, isJson bool) ([]byte, int, error) {
+	return e.failover(ctx, func(serviceURL string) ([]byte, int, error) {
+		reqURL := serviceURL + "/" + slug
+		req, err := http.NewRequestWithContext(ctx, "POST", reqURL, bytes.NewReader(reqBody))
+		if err != nil {
+			log.Errorf("Could not create POST %s with body %s, error: %s", redactURL(reqURL), string(reqBody), err.Error())
+			return nil, -1, err
+		}
+		log.Debugf("postBody: %s %s : %s\n", req.Method, req.URL.Redacted(), string(reqBody))
+		body, rcode, err := e.netReqTyped(req, isJson)
+		if err != nil {
+			log.Errorf("Could not complete POST %s with body %s, error: %s", redactURL(reqURL), string(reqBody), err.Error())
+			return nil, rcode, err
+		}
+		//eurekaCache.Flush()
+		return body, rcode, nil
+	})
+}
+
+func (e *EurekaConnection) putKV(ctx context.Context, slug string, pairs map[string]string) ([]byte, int, error) {
 	params := url.Values{}
 	for k, v := range pairs {
 		params.Add(k, v)
 	}
-	parameterizedURL := reqURL + "?" + params.Encode()
-	log.Noticef("Sending KV request with URL %s", parameterizedURL)
-	req, err := http.NewRequest("PUT", parameterizedURL, nil)
-	if err != nil {
-		log.Errorf("Could not create PUT %s, error: %s", reqURL, err.Error())
-		return nil, -1, err
-	}
-	body, rcode, err := netReq(req) // TODO(cq) I think this can just be netReq() since there is no body
-	if err != nil {
-		log.Errorf("Could not complete PUT %s, error: %s", reqURL, err.Error())
-		return nil, rcode, err
-	}
-	return body, rcode, nil
+	return e.failover(ctx, func(serviceURL string) ([]byte, int, error) {
+		reqURL := serviceURL + "/" + slug
+		parameterizedURL := reqURL
+		if len(params) > 0 {
+			parameterizedURL += "?" + params.Encode()
+			// Leave a request without pairs, such as a heartbeat, to its caller to log, lest
+			// every renewal of every lease log a notice.
+			log.Noticef("Sending KV request with URL %s", redactURL(parameterizedURL))
+		}
+		req, err := http.NewRequestWithContext(ctx, "PUT", parameterizedURL, nil)
+		if err != nil {
+			log.Errorf("Could not create PUT %s, error: %s", redactURL(reqURL), err.Error())
+			return nil, -1, err
+		}
+		body, rcode, err := e.netReq(req) // TODO(cq) I think this can just be netReq() since there is no body
+		if err != nil {
+			log.Errorf("Could not complete PUT %s, error: %s", redactURL(reqURL), err.Error())
+			return nil, rcode, err
+		}
+		return body, rcode, nil
+	})
 }
 
-func getBody(reqURL string, isJson bool) ([]byte, int, error) {
-	req, err := http.NewRequest("GET", reqURL, nil)
-	if err != nil {
-		log.Errorf("Could not create GET %s, error: %s", reqURL, err.Error())
-		return nil, -1, err
-	}
-	body, rcode, err := netReqTyped(req, isJson)
-	if err != nil {
-		log.Errorf("Could not complete GET %s, error: %s", reqURL, err.Error())
-		return nil, rcode, err
-	}
-	return body, rcode, nil
+func (e *EurekaConnection) getBody(ctx context.Context, slug string, isJson bool) ([]byte, int, error) {
+	return e.failover(ctx, func(serviceURL string) ([]byte, int, error) {
+		reqURL := serviceURL + "/" + slug
+		req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+		if err != nil {
+			log.Errorf("Could not create GET %s, error: %s", redactURL(reqURL), err.Error())
+			return nil, -1, err
+		}
+		body, rcode, err := e.netReqTyped(req, isJson)
+		if err != nil {
+			log.Errorf("Could not complete GET %s, error: %s", redactURL(reqURL), err.Error())
+			return nil, rcode, err
+		}
+		return body, rcode, nil
+	})
 }
 
-func deleteReq(reqURL string) (int, error) {
-	req, err := http.NewRequest("DELETE", reqURL, nil)
-	if err != nil {
-		log.Errorf("Could not create DELETE %s, error: %s", reqURL, err.Error())
-		return -1, err
-	}
-	_, rcode, err := netReq(req)
-	if err != nil {
-		log.Errorf("Could not complete DELETE %s, error: %s", reqURL, err.Error())
-		return rcode, err
-	}
-	return rcode, nil
+func (e *EurekaConnection) deleteReq(ctx context.Context, slug string, params url.Values) (int, error) {
+	_, rcode, err := e.failover(ctx, func(serviceURL string) ([]byte, int, error) {
+		reqURL := serviceURL + "/" + slug
+		parameterizedURL := reqURL
+		if len(params) > 0 {
+			parameterizedURL += "?" + params.Encode()
+		}
+		req, err := http.NewRequestWithContext(ctx, "DELETE", parameterizedURL, nil)
+		if err != nil {
+			log.Errorf("Could not create DELETE %s, error: %s", redactURL(reqURL), err.Error())
+			return nil, -1, err
+		}
+		_, rcode, err := e.netReq(req)
+		if err != nil {
+			log.Errorf("Could not complete DELETE %s, error: %s", redactURL(reqURL), err.Error())
+			return nil, rcode, err
+		}
+		return nil, rcode, nil
+	})
+	return rcode, err
 }
 
-func netReqTyped(req *http.Request, isJson bool) ([]byte, int, error) {
+func (e *EurekaConnection) netReqTyped(req *http.Request, isJson bool) ([]byte, int, error) {
 	if isJson {
 		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set("Accept", "application/json")
@@ -95,20 +156,46 @@ func netReqTyped(req *http.Request, isJson bool) ([]byte, int, error) {
 		req.Header.Set("Content-Type", "application/xml")
 		req.Header.Set("Accept", "application/xml")
 	}
-	return netReq(req)
+	return e.netReq(req)
 }
 
-func netReq(req *http.Request) ([]byte, int, error) {
+// netReq sends the given request using the connection's HTTP client, retrying a few times in the
+// face of temporary network failures. It abandons the request—including any pending retry—as soon
+// as the request's context is done, or once the connection's Timeout elapses, if it has one. The
+// connection's ConnectTimeout bounds only establishing the connection. If it fails to authenticate
+// the request or to load the connection's TLS settings, it returns a *requestSetupError without
+// sending anything.
+func (e *EurekaConnection) netReq(req *http.Request) ([]byte, int, error) {
+	ctx := req.Context()
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
+	}
+	if e.ConnectTimeout > 0 {
+		ctx = context.WithValue(ctx, connectTimeoutKey{}, e.ConnectTimeout)
+	}
+	req = req.WithContext(ctx)
+	if err := e.authenticate(req); err != nil {
+		return nil, -1, &requestSetupError{err}
+	}
+	client, err := e.httpClient()
+	if err != nil {
+		return nil, -1, &requestSetupError{err}
+	}
 	var resp *http.Response
-	var err error
 	for i := 0; i < 3; i++ {
-		resp, err = HttpClient.Do(req)
-		if nerr, ok := err.(net.Error); ok && nerr.Temporary() {
+		resp, err = client.Do(req)
+		if nerr, ok := err.(net.Error); ok && nerr.Temporary() && ctx.Err() == nil {
 			// it's a transient network error so we sleep for a bit and try
 			// again in case it's a short-lived issue
 			log.Warningf("Retrying after temporary network failure, error: %s",
 				nerr.Error())
-			time.Sleep(10)
+			select {
+			case <-ctx.Done():
+				return nil, -1, ctx.Err()
+			case <-time.After(10 * time.Millisecond):
+			}
 		} else {
 			break
 		}
@@ -1,10 +1,13 @@
 package fargo
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -26,15 +29,18 @@ func TestHttpClient(t *testing.T) {
 
 	Convey("Given fargo.HttpClient is set to a custom client", t, func() {
 		rt := new(roundtripper)
+		defaultClient := HttpClient
 		HttpClient = &http.Client{
 			Transport: rt,
 		}
+		Reset(func() { HttpClient = defaultClient })
 
-		Convey("netReq uses that client to handle requests", func() {
+		Convey("netReq uses that client to handle requests for a connection without its own client", func() {
 			req, err := http.NewRequest("GET", server.URL, nil)
 			So(err, ShouldBeNil)
 
-			respBody, respCode, err := netReq(req)
+			var e EurekaConnection
+			respBody, respCode, err := e.netReq(req)
 			So(err, ShouldBeNil)
 			So(respCode, ShouldEqual, 200)
 			So(string(respBody), ShouldEqual, "Hello World")
@@ -43,3 +49,102 @@ func TestHttpClient(t *testing.T) {
 		})
 	})
 }
+
+func TestNetReqHonorsContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	Convey("Given a request bound to a context", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		req, err := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+		So(err, ShouldBeNil)
+
+		Convey("netReq gives up once that context is canceled", func() {
+			time.AfterFunc(50*time.Millisecond, cancel)
+			e := EurekaConnection{HTTPClient: &http.Client{Transport: new(roundtripper)}}
+			_, respCode, err := e.netReq(req)
+			So(err, ShouldNotBeNil)
+			So(errors.Is(err, context.Canceled), ShouldBeTrue)
+			So(respCode, ShouldEqual, -1)
+		})
+	})
+}
+
+func TestConnectionHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+		}
+		fmt.Fprint(w, "Hello World")
+	}))
+	defer server.Close()
+
+	Convey("Given connections with their own HTTP clients", t, func() {
+		global := new(roundtripper)
+		defaultClient := HttpClient
+		HttpClient = &http.Client{
+			Transport: global,
+		}
+		Reset(func() { HttpClient = defaultClient })
+		first, second := new(roundtripper), new(roundtripper)
+		e1 := EurekaConnection{HTTPClient: &http.Client{Transport: first}}
+		e2 := EurekaConnection{HTTPClient: &http.Client{Transport: second}}
+
+		Convey("each connection uses only its own client", func() {
+			req, err := http.NewRequest("GET", server.URL, nil)
+			So(err, ShouldBeNil)
+			_, respCode, err := e1.netReq(req)
+			So(err, ShouldBeNil)
+			So(respCode, ShouldEqual, 200)
+			So(first.TripCount, ShouldEqual, 1)
+			So(second.TripCount, ShouldEqual, 0)
+			So(global.TripCount, ShouldEqual, 0)
+
+			_, _, err = e2.netReq(req)
+			So(err, ShouldBeNil)
+			So(first.TripCount, ShouldEqual, 1)
+			So(second.TripCount, ShouldEqual, 1)
+			So(global.TripCount, ShouldEqual, 0)
+		})
+
+		Convey("a connection's timeout bounds its requests", func() {
+			e1.Timeout = 50 * time.Millisecond
+			req, err := http.NewRequest("GET", server.URL+"/slow", nil)
+			So(err, ShouldBeNil)
+			_, _, err = e1.netReq(req)
+			So(err, ShouldNotBeNil)
+			So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+		})
+
+		Convey("a connection's connect timeout doesn't bound reading a slow response", func() {
+			e := EurekaConnection{
+				HTTPClient:     &http.Client{Transport: transport},
+				ConnectTimeout: 50 * time.Millisecond,
+			}
+			req, err := http.NewRequest("GET", server.URL+"/slow", nil)
+			So(err, ShouldBeNil)
+			body, respCode, err := e.netReq(req)
+			So(err, ShouldBeNil)
+			So(respCode, ShouldEqual, 200)
+			So(string(body), ShouldEqual, "Hello World")
+		})
+	})
+
+	Convey("A connection made from configuration applies its connect timeout only to connecting", t, func() {
+		conf := Config{}
+		conf.fillDefaults()
+		e := NewConnFromConfig(conf)
+		So(e.ConnectTimeout, ShouldEqual, 10*time.Second)
+		So(e.Timeout, ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,330 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Defaults for quarantining Eureka servers after failed requests, used when a connection's
+// QuarantineDuration or MaxQuarantineDuration is zero.
+const (
+	DefaultQuarantineDuration    = 30 * time.Second
+	DefaultMaxQuarantineDuration = 5 * time.Minute
+)
+
+// ServerState describes how a connection regards one of its Eureka servers.
+type ServerState struct {
+	// ServiceURL identifies the Eureka server, with any embedded password masked.
+	ServiceURL string
+	// Zone is the availability zone of the Eureka server, if known.
+	Zone string
+	// Healthy is false while the server is quarantined following failed requests.
+	Healthy bool
+	// QuarantinedUntil is the time at which a quarantined server will next be probed. It's zero
+	// for a healthy server.
+	QuarantinedUntil time.Time
+	// ConsecutiveFailures counts the failed requests and probes since the server last responded.
+	ConsecutiveFailures int
+	// LastError is the error from the most recent failed request or probe, if any.
+	LastError error
+	// LastLatency is how long the server took to respond to the most recent successful request.
+	LastLatency time.Duration
+	// LastSuccess and LastFailure note when the server last responded or failed to respond. Each is
+	// zero if no such request has yet occurred.
+	LastSuccess time.Time
+	LastFailure time.Time
+}
+
+type serverRecord struct {
+	state   ServerState
+	probing bool
+}
+
+// serverTracker remembers which of a connection's Eureka servers recently failed, quarantining
+// each failed server for a period that grows exponentially with its consecutive failures.
+type serverTracker struct {
+	m       sync.Mutex
+	servers map[string]*serverRecord
+	// probes holds the timers for scheduled probes of quarantined servers. It's nil once the
+	// tracker is closed.
+	probes map[string]*time.Timer
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newServerTracker() *serverTracker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &serverTracker{
+		servers: make(map[string]*serverRecord),
+		probes:  make(map[string]*time.Timer),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// scheduleProbe arranges for probe to run after the given delay, unless the tracker is closed
+// first.
+func (t *serverTracker) scheduleProbe(serviceURL string, d time.Duration, probe func(ctx context.Context)) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	if t.probes == nil {
+		return
+	}
+	t.probes[serviceURL] = time.AfterFunc(d, func() {
+		t.m.Lock()
+		delete(t.probes, serviceURL)
+		t.m.Unlock()
+		probe(t.ctx)
+	})
+}
+
+// close stops all scheduled probes, abandons any probe in flight, and precludes scheduling more.
+func (t *serverTracker) close() {
+	t.m.Lock()
+	defer t.m.Unlock()
+	for _, timer := range t.probes {
+		timer.Stop()
+	}
+	t.probes = nil
+	t.cancel()
+}
+
+// retain forgets any servers other than those given, and returns the records for those that
+// remain.
+func (t *serverTracker) retain(urls []string) map[string]ServerState {
+	t.m.Lock()
+	defer t.m.Unlock()
+	states := make(map[string]ServerState, len(urls))
+	for _, u := range urls {
+		if r, ok := t.servers[u]; ok {
+			states[u] = r.state
+		}
+	}
+	if len(t.servers) > len(states) {
+		for u := range t.servers {
+			if _, ok := states[u]; !ok {
+				delete(t.servers, u)
+			}
+		}
+	}
+	return states
+}
+
+func (t *serverTracker) record(serviceURL string) *serverRecord {
+	r, ok := t.servers[serviceURL]
+	if !ok {
+		r = &serverRecord{state: ServerState{ServiceURL: redactURL(serviceURL), Healthy: true}}
+		t.servers[serviceURL] = r
+	}
+	return r
+}
+
+func (t *serverTracker) recordSuccess(serviceURL string, latency time.Duration) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	r := t.record(serviceURL)
+	if !r.state.Healthy {
+		log.Noticef("Eureka server %s is responding again, releasing it from quarantine", r.state.ServiceURL)
+	}
+	r.state.Healthy = true
+	r.state.QuarantinedUntil = time.Time{}
+	r.state.ConsecutiveFailures = 0
+	r.state.LastLatency = latency
+	r.state.LastSuccess = time.Now()
+}
+
+// recordFailure quarantines the server, returning how long the quarantine lasts, and whether the
+// caller should schedule a probe of the server for when the quarantine ends.
+func (t *serverTracker) recordFailure(serviceURL string, err error, base, max time.Duration) (time.Duration, bool) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	r := t.record(serviceURL)
+	r.state.ConsecutiveFailures++
+	d := base
+	for i := 1; i < r.state.ConsecutiveFailures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	now := time.Now()
+	r.state.Healthy = false
+	r.state.QuarantinedUntil = now.Add(d)
+	r.state.LastError = err
+	r.state.LastFailure = now
+	if r.probing {
+		return d, false
+	}
+	r.probing = true
+	return d, true
+}
+
+// deferProbe keeps the server quarantined as it is, without counting another failure, returning
+// whether the caller should schedule another probe of the server.
+func (t *serverTracker) deferProbe(serviceURL string) bool {
+	t.m.Lock()
+	defer t.m.Unlock()
+	r, ok := t.servers[serviceURL]
+	if !ok || r.probing || r.state.Healthy {
+		return false
+	}
+	r.probing = true
+	return true
+}
+
+// beginProbe reports whether the server is still tracked and due a probe.
+func (t *serverTracker) beginProbe(serviceURL string) bool {
+	t.m.Lock()
+	defer t.m.Unlock()
+	r, ok := t.servers[serviceURL]
+	if !ok {
+		return false
+	}
+	r.probing = false
+	return !r.state.Healthy
+}
+
+func (e *EurekaConnection) quarantineDurations() (time.Duration, time.Duration) {
+	base, max := e.QuarantineDuration, e.MaxQuarantineDuration
+	if base <= 0 {
+		base = DefaultQuarantineDuration
+	}
+	if max <= 0 {
+		max = DefaultMaxQuarantineDuration
+	}
+	if max < base {
+		max = base
+	}
+	return base, max
+}
+
+func (e *EurekaConnection) recordServerSuccess(serviceURL string, latency time.Duration) {
+	if e.servers != nil {
+		e.servers.recordSuccess(serviceURL, latency)
+	}
+}
+
+func (e *EurekaConnection) recordServerFailure(serviceURL string, err error) {
+	if e.servers == nil {
+		return
+	}
+	base, max := e.quarantineDurations()
+	d, schedule := e.servers.recordFailure(serviceURL, err, base, max)
+	log.Warningf("Quarantining Eureka server %s for %s", redactURL(serviceURL), d)
+	if schedule {
+		e.servers.scheduleProbe(serviceURL, d, func(ctx context.Context) {
+			e.probeServer(ctx, serviceURL)
+		})
+	}
+}
+
+// probeServer checks whether a quarantined Eureka server has recovered, extending its quarantine if
+// it hasn't.
+func (e *EurekaConnection) probeServer(ctx context.Context, serviceURL string) {
+	if ctx.Err() != nil || !e.servers.beginProbe(serviceURL) {
+		return
+	}
+	reqURL := serviceURL + "/" + generatePath(EurekaURLSlugs["Apps"], "delta")
+	log.Debugf("Probing quarantined Eureka server with url %s", redactURL(reqURL))
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		e.recordServerFailure(serviceURL, err)
+		return
+	}
+	start := time.Now()
+	_, rcode, err := e.netReqTyped(req, e.UseJson)
+	if ctx.Err() != nil {
+		return
+	}
+	if isRequestSetupError(err) {
+		// The probe never reached the server, so try again later without extending its quarantine.
+		if base, _ := e.quarantineDurations(); e.servers.deferProbe(serviceURL) {
+			e.servers.scheduleProbe(serviceURL, base, func(ctx context.Context) {
+				e.probeServer(ctx, serviceURL)
+			})
+		}
+		return
+	}
+	if err == nil && rcode >= http.StatusInternalServerError {
+		err = &unsuccessfulHTTPResponse{rcode, "Eureka server error"}
+	}
+	if err != nil {
+		e.recordServerFailure(serviceURL, err)
+		return
+	}
+	e.recordServerSuccess(serviceURL, time.Since(start))
+}
+
+// orderServiceURLs arranges the given service URLs in the order in which a request should try
+// them: healthy servers first, in random order, followed by quarantined servers, soonest to be
+// released first. If the connection prefers servers in its own zone, healthy servers in that zone
+// precede healthy servers in other zones.
+func (e *EurekaConnection) orderServiceURLs(urls []string) []string {
+	ordered := make([]string, len(urls))
+	for i, j := range rand.Perm(len(urls)) {
+		ordered[i] = urls[j]
+	}
+	var states map[string]ServerState
+	if e.servers != nil {
+		states = e.servers.retain(urls)
+	}
+	var zones map[string]string
+	localZone := ""
+	if e.PreferSameZone {
+		if localZone = e.LocalZone(); len(localZone) > 0 {
+			zones = e.serviceURLZones()
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		ui, uj := ordered[i], ordered[j]
+		// Healthy servers have a zero quarantine time, preceding all others.
+		qi, qj := states[ui].QuarantinedUntil, states[uj].QuarantinedUntil
+		if hi, hj := qi.IsZero(), qj.IsZero(); hi != hj {
+			return hi
+		} else if !hi {
+			return qi.Before(qj)
+		}
+		return zones[ui] == localZone && zones[uj] != localZone
+	})
+	return ordered
+}
+
+// ServerStates reports how the connection regards each of its Eureka servers, indicating which
+// are considered usable and which are quarantined following failed requests.
+//
+// Only connections created by NewConn, NewConnFromConfig, or NewConnFromConfigFile track their
+// servers' health. For other connections, every server is reported as healthy.
+func (e *EurekaConnection) ServerStates() []ServerState {
+	urls := e.ServiceUrls
+	var states map[string]ServerState
+	if e.servers != nil {
+		states = e.servers.retain(urls)
+	}
+	zones := e.serviceURLZones()
+	result := make([]ServerState, len(urls))
+	for i, u := range urls {
+		if s, ok := states[u]; ok {
+			result[i] = s
+		} else {
+			result[i] = ServerState{ServiceURL: redactURL(u), Healthy: true}
+		}
+		result[i].Zone = zones[u]
+	}
+	return result
+}
+
+// Close stops the connection's background probes of quarantined Eureka servers. Copies of the
+// connection share these probes, so closing one closes them all. Requests may still be sent over
+// a closed connection, but quarantined servers are then released only when a request succeeds
+// against them.
+func (e *EurekaConnection) Close() {
+	if e.servers != nil {
+		e.servers.close()
+	}
+}
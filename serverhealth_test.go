@@ -0,0 +1,135 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func findServerState(e *EurekaConnection, serviceURL string) ServerState {
+	for _, s := range e.ServerStates() {
+		if s.ServiceURL == serviceURL {
+			return s
+		}
+	}
+	panic("no state for " + serviceURL)
+}
+
+func TestServerQuarantine(t *testing.T) {
+	var healthyHits, flakyHits int32
+	var flakyRecovered atomic.Value
+	flakyRecovered.Store(false)
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&healthyHits, 1)
+	}))
+	defer healthy.Close()
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&flakyHits, 1)
+		if !flakyRecovered.Load().(bool) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer flaky.Close()
+
+	heartbeat := func(e *EurekaConnection) error {
+		return e.HeartBeatInstance(&Instance{App: "TESTAPP", HostName: "i-123456"})
+	}
+
+	Convey("Given a connection to a healthy and a failing server", t, func() {
+		atomic.StoreInt32(&healthyHits, 0)
+		atomic.StoreInt32(&flakyHits, 0)
+		flakyRecovered.Store(false)
+		e := NewConn(flaky.URL, healthy.URL)
+		defer e.Close()
+		e.QuarantineDuration = time.Hour
+
+		Convey("both servers start out healthy", func() {
+			for _, s := range e.ServerStates() {
+				So(s.Healthy, ShouldBeTrue)
+			}
+		})
+
+		Convey("once the failing server fails a request", func() {
+			for findServerState(&e, flaky.URL).Healthy {
+				So(heartbeat(&e), ShouldBeNil)
+			}
+			Convey("it's reported as quarantined", func() {
+				s := findServerState(&e, flaky.URL)
+				So(s.ConsecutiveFailures, ShouldEqual, 1)
+				So(s.QuarantinedUntil, ShouldHappenAfter, time.Now().Add(59*time.Minute))
+				So(s.LastError, shouldBearHTTPStatusCode, http.StatusInternalServerError)
+				So(s.LastFailure, ShouldNotBeZeroValue)
+			})
+			Convey("the healthy server is reported as such", func() {
+				s := findServerState(&e, healthy.URL)
+				So(s.Healthy, ShouldBeTrue)
+				So(s.LastSuccess, ShouldNotBeZeroValue)
+				So(s.LastLatency, ShouldBeGreaterThan, 0)
+			})
+			Convey("subsequent requests avoid it", func() {
+				before := atomic.LoadInt32(&flakyHits)
+				for i := 0; i < 10; i++ {
+					So(heartbeat(&e), ShouldBeNil)
+				}
+				So(atomic.LoadInt32(&flakyHits), ShouldEqual, before)
+				So(selectServiceURL(&e), ShouldEqual, healthy.URL)
+			})
+			Convey("it's still tried when no healthy server remains", func() {
+				e.recordServerFailure(healthy.URL, errors.New("unreachable"))
+				before := atomic.LoadInt32(&flakyHits)
+				heartbeat(&e)
+				So(atomic.LoadInt32(&flakyHits), ShouldEqual, before+1)
+			})
+		})
+
+		Convey("a quarantined server is probed and released once it recovers", func() {
+			e.QuarantineDuration = 10 * time.Millisecond
+			e.recordServerFailure(flaky.URL, errors.New("unreachable"))
+			So(findServerState(&e, flaky.URL).Healthy, ShouldBeFalse)
+			flakyRecovered.Store(true)
+			deadline := time.Now().Add(5 * time.Second)
+			for !findServerState(&e, flaky.URL).Healthy && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			s := findServerState(&e, flaky.URL)
+			So(s.Healthy, ShouldBeTrue)
+			So(s.ConsecutiveFailures, ShouldEqual, 0)
+		})
+
+		Convey("a closed connection no longer probes quarantined servers", func() {
+			e.QuarantineDuration = 10 * time.Millisecond
+			e.recordServerFailure(flaky.URL, errors.New("unreachable"))
+			e.Close()
+			before := atomic.LoadInt32(&flakyHits)
+			time.Sleep(50 * time.Millisecond)
+			So(atomic.LoadInt32(&flakyHits), ShouldEqual, before)
+			So(findServerState(&e, flaky.URL).Healthy, ShouldBeFalse)
+		})
+	})
+}
+
+func TestServerQuarantineBackoff(t *testing.T) {
+	Convey("Consecutive failures lengthen a server's quarantine", t, func() {
+		tracker := newServerTracker()
+		base, max := time.Second, 5*time.Second
+		var durations []time.Duration
+		for i := 0; i < 5; i++ {
+			d, _ := tracker.recordFailure("http://eureka", errors.New("unreachable"), base, max)
+			durations = append(durations, d)
+		}
+		So(durations, ShouldResemble, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second})
+
+		Convey("until the server responds again", func() {
+			tracker.recordSuccess("http://eureka", time.Millisecond)
+			d, _ := tracker.recordFailure("http://eureka", errors.New("unreachable"), base, max)
+			So(d, ShouldEqual, base)
+		})
+	})
+}
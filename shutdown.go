@@ -0,0 +1,165 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ShutdownOptions tailor how Shutdown removes an instance from service.
+type ShutdownOptions struct {
+	// Drain is how long to wait after marking the instance OUT_OF_SERVICE before deregistering it,
+	// giving clients polling Eureka time to notice and stop sending it traffic. It's typically
+	// set to the clients' polling interval.
+	Drain time.Duration
+	// Timeout bounds the time taken by the whole shutdown, including the drain. If zero, only the
+	// supplied context bounds it. It should exceed Drain, leaving time to deregister the instance.
+	Timeout time.Duration
+	// Lease, if not nil, is the LeaseManager keeping the instance registered. Shutdown stops it
+	// rather than deregistering the instance directly, precluding it from registering the
+	// instance again.
+	Lease *LeaseManager
+}
+
+// ShutdownStepError records the failure of a single step of a shutdown.
+type ShutdownStepError struct {
+	// Step names the step that failed.
+	Step string
+	Err  error
+}
+
+func (e *ShutdownStepError) Error() string {
+	return e.Step + ": " + e.Err.Error()
+}
+
+// Unwrap returns the cause of the failed step.
+func (e *ShutdownStepError) Unwrap() error {
+	return e.Err
+}
+
+// ShutdownError reports the steps that failed during a shutdown, in the order they were taken.
+type ShutdownError struct {
+	Failures []*ShutdownStepError
+}
+
+func (e *ShutdownError) Error() string {
+	msgs := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		msgs[i] = f.Error()
+	}
+	return fmt.Sprintf("%d shutdown steps failed: %s", len(e.Failures), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the error from the first failed step.
+func (e *ShutdownError) Unwrap() error {
+	if len(e.Failures) == 0 {
+		return nil
+	}
+	return e.Failures[0]
+}
+
+// Names of the steps of a shutdown, as reported in a ShutdownStepError
+const (
+	ShutdownStepMarkOutOfService = "mark out of service"
+	ShutdownStepDrain            = "drain"
+	ShutdownStepDeregister       = "deregister"
+)
+
+// Shutdown removes the given instance from service gracefully: it marks the instance
+// OUT_OF_SERVICE, waits for the drain duration, and then deregisters the instance. It attempts
+// every step even if an earlier one fails, abandoning the remaining steps only once the supplied
+// context is done or the timeout elapses. If any step fails, it returns a ShutdownError describing
+// each failure.
+func (e *EurekaConnection) Shutdown(ctx context.Context, ins *Instance, opts ShutdownOptions) error {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	var failures []*ShutdownStepError
+	fail := func(step string, err error) {
+		log.Errorf("Failed to %s Instance=%s App=%s during shutdown, error: %s", step, ins.Id(), ins.App, err.Error())
+		failures = append(failures, &ShutdownStepError{step, err})
+	}
+
+	log.Noticef("Shutting down Instance=%s App=%s, marking it out of service", ins.Id(), ins.App)
+	if err := e.UpdateInstanceStatusContext(ctx, ins, OUTOFSERVICE); err != nil {
+		fail(ShutdownStepMarkOutOfService, err)
+	}
+
+	if opts.Drain > 0 {
+		log.Noticef("Draining Instance=%s App=%s for %s", ins.Id(), ins.App, opts.Drain)
+		t := time.NewTimer(opts.Drain)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			fail(ShutdownStepDrain, ctx.Err())
+		}
+	}
+
+	log.Noticef("Deregistering Instance=%s App=%s", ins.Id(), ins.App)
+	if err := e.deregisterForShutdown(ctx, ins, opts.Lease); err != nil {
+		fail(ShutdownStepDeregister, err)
+	}
+
+	if len(failures) > 0 {
+		return &ShutdownError{failures}
+	}
+	return nil
+}
+
+func (e *EurekaConnection) deregisterForShutdown(ctx context.Context, ins *Instance, lease *LeaseManager) error {
+	if lease == nil {
+		return e.DeregisterInstanceContext(ctx, ins)
+	}
+	if err := ctx.Err(); err != nil {
+		// Stop renewing the lease regardless, so that the instance's registration lapses.
+		go lease.Stop()
+		return err
+	}
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- lease.Stop()
+	}()
+	select {
+	case err := <-stopped:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ShutdownOnSignal waits for the process to receive one of the given signals, or SIGTERM or SIGINT
+// if none are given, and then calls Shutdown for the given instance, sending its outcome to the
+// returned channel. If the supplied context is done before any such signal arrives, it stops
+// waiting and closes the returned channel without sending a value.
+//
+// Once a signal arrives, the supplied context no longer governs the shutdown; the options' Timeout
+// bounds it instead.
+func (e *EurekaConnection) ShutdownOnSignal(ctx context.Context, ins *Instance, opts ShutdownOptions, signals ...os.Signal) <-chan error {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGTERM, os.Interrupt}
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, signals...)
+	c := make(chan error, 1)
+	go func() {
+		defer close(c)
+		defer signal.Stop(sigs)
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-sigs:
+			log.Noticef("Received signal %s, shutting down", sig)
+		}
+		c <- e.Shutdown(context.Background(), ins, opts)
+	}()
+	return c
+}
@@ -0,0 +1,115 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestShutdown(t *testing.T) {
+	var m sync.Mutex
+	var requests []string
+	statusCode := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == "PUT" && r.URL.Path == "/apps/TESTAPP/i-123456/status" {
+			if v := r.URL.Query().Get("value"); v != string(OUTOFSERVICE) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		w.WriteHeader(statusCode)
+	}))
+	defer server.Close()
+	ins := validInstance()
+	requested := func() []string {
+		m.Lock()
+		defer m.Unlock()
+		return append([]string(nil), requests...)
+	}
+
+	Convey("Given a connection to Eureka", t, func() {
+		m.Lock()
+		requests = nil
+		statusCode = http.StatusOK
+		m.Unlock()
+		e := NewConn(server.URL)
+
+		Convey("shutting down marks the instance out of service, drains, and deregisters it", func() {
+			start := time.Now()
+			err := e.Shutdown(context.Background(), ins, ShutdownOptions{Drain: 50 * time.Millisecond})
+			So(err, ShouldBeNil)
+			So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 50*time.Millisecond)
+			So(requested(), ShouldResemble, []string{
+				"PUT /apps/TESTAPP/i-123456/status",
+				"DELETE /apps/TESTAPP/i-123456",
+			})
+		})
+
+		Convey("failed steps are reported together", func() {
+			m.Lock()
+			statusCode = http.StatusNotFound
+			m.Unlock()
+			err := e.Shutdown(context.Background(), ins, ShutdownOptions{})
+			var shutdownErr *ShutdownError
+			So(errors.As(err, &shutdownErr), ShouldBeTrue)
+			So(shutdownErr.Failures, ShouldHaveLength, 2)
+			So(shutdownErr.Failures[0].Step, ShouldEqual, ShutdownStepMarkOutOfService)
+			So(shutdownErr.Failures[1].Step, ShouldEqual, ShutdownStepDeregister)
+			So(err, shouldBearHTTPStatusCode, http.StatusNotFound)
+		})
+
+		Convey("the timeout bounds the shutdown", func() {
+			start := time.Now()
+			err := e.Shutdown(context.Background(), ins, ShutdownOptions{Drain: time.Hour, Timeout: 50 * time.Millisecond})
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+			var shutdownErr *ShutdownError
+			So(errors.As(err, &shutdownErr), ShouldBeTrue)
+			So(shutdownErr.Failures[0].Step, ShouldEqual, ShutdownStepDrain)
+			So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+		})
+
+		Convey("a lease manager is stopped rather than left to register the instance again", func() {
+			lease, err := e.newLeaseManager(context.Background(), ins, time.Hour)
+			So(err, ShouldBeNil)
+			So(e.Shutdown(context.Background(), ins, ShutdownOptions{Lease: lease}), ShouldBeNil)
+			<-lease.Done()
+			So(requested(), ShouldContain, "DELETE /apps/TESTAPP/i-123456")
+		})
+
+		Convey("a signal triggers the shutdown", func() {
+			if runtime.GOOS == "windows" {
+				return
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := e.ShutdownOnSignal(ctx, ins, ShutdownOptions{}, os.Interrupt)
+			p, err := os.FindProcess(os.Getpid())
+			So(err, ShouldBeNil)
+			So(p.Signal(os.Interrupt), ShouldBeNil)
+			So(<-done, ShouldBeNil)
+			So(requested(), ShouldContain, "DELETE /apps/TESTAPP/i-123456")
+		})
+
+		Convey("no shutdown occurs if the context is done before a signal arrives", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			done := e.ShutdownOnSignal(ctx, ins, ShutdownOptions{})
+			cancel()
+			_, ok := <-done
+			So(ok, ShouldBeFalse)
+			So(requested(), ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,111 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// snapshotPath returns the path of the file within the connection's SnapshotDir holding the
+// snapshot identified by the given parts, or an empty string if the connection doesn't persist
+// snapshots.
+func (e *EurekaConnection) snapshotPath(parts ...string) string {
+	if len(e.SnapshotDir) == 0 {
+		return ""
+	}
+	for i, p := range parts {
+		parts[i] = url.QueryEscape(p)
+	}
+	ext := ".xml"
+	if e.UseJson {
+		ext = ".json"
+	}
+	return filepath.Join(e.SnapshotDir, strings.Join(parts, "-")+ext)
+}
+
+func (e *EurekaConnection) marshalSnapshot(apps []*Application) ([]byte, error) {
+	r := &GetAppsResponse{Applications: apps}
+	if e.UseJson {
+		return json.Marshal(GetAppsResponseJson{r})
+	}
+	var b bytes.Buffer
+	if err := xml.NewEncoder(&b).EncodeElement(r, startLocalName("applications")); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// saveSnapshot writes the given applications to the snapshot file at the given path, in the same
+// format the connection uses to communicate with Eureka. It replaces any previous snapshot in a
+// single step, so that a reader never observes a partially written file.
+func (e *EurekaConnection) saveSnapshot(path string, apps []*Application) {
+	if len(path) == 0 {
+		return
+	}
+	b, err := e.marshalSnapshot(apps)
+	if err != nil {
+		log.Warningf("Failed to encode snapshot %s, error: %s", path, err.Error())
+		return
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		log.Warningf("Failed to create snapshot %s, error: %s", path, err.Error())
+		return
+	}
+	_, err = f.Write(b)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		log.Warningf("Failed to write snapshot %s, error: %s", path, err.Error())
+		return
+	}
+	log.Debugf("Wrote snapshot %s", path)
+}
+
+// loadSnapshot reads the applications from the snapshot file at the given path. It returns false
+// if there is no such file, or if the file can't be read.
+func (e *EurekaConnection) loadSnapshot(path string) ([]*Application, bool) {
+	if len(path) == 0 {
+		return nil, false
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Debugf("No snapshot found at %s", path)
+		} else {
+			log.Warningf("Failed to read snapshot %s, error: %s", path, err.Error())
+		}
+		return nil, false
+	}
+	var r *GetAppsResponse
+	if e.UseJson {
+		var rj GetAppsResponseJson
+		err = json.Unmarshal(b, &rj)
+		r = rj.Response
+	} else {
+		err = xml.Unmarshal(b, &r)
+	}
+	if err != nil {
+		log.Warningf("Failed to decode snapshot %s, error: %s", path, err.Error())
+		return nil, false
+	}
+	if r == nil {
+		r = &GetAppsResponse{}
+	}
+	for _, app := range r.Applications {
+		app.ParseAllMetadata()
+	}
+	log.Noticef("Loaded snapshot %s, marking its data as stale until Eureka responds", path)
+	return r.Applications, true
+}
@@ -0,0 +1,133 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const snapshotAppXML = `<application>
+  <name>TESTAPP</name>
+  <instance><hostName>i-1</hostName><app>TESTAPP</app><vipAddress>testapp</vipAddress><status>UP</status><port enabled="true">8080</port><metadata><weight>10</weight></metadata></instance>
+  <instance><hostName>i-2</hostName><app>TESTAPP</app><vipAddress>testapp</vipAddress><status>DOWN</status><port enabled="true">8080</port></instance>
+</application>`
+
+func TestSnapshots(t *testing.T) {
+	available := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		switch {
+		case r.URL.Path == "/apps/TESTAPP":
+			w.Write([]byte(snapshotAppXML))
+		case strings.HasPrefix(r.URL.Path, "/vips/"), r.URL.Path == "/apps":
+			w.Write([]byte("<applications>" + snapshotAppXML + "</applications>"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	Convey("Given a connection that persists snapshots", t, func() {
+		available = true
+		dir, err := os.MkdirTemp("", "fargo-snapshots")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		e := NewConn(server.URL)
+		e.PollInterval = time.Hour
+		e.SnapshotDir = dir
+
+		Convey("an instance set source seeds itself from the last snapshot when Eureka is down", func() {
+			s, err := e.NewInstanceSetSourceForVIPAddress("testapp", false, true, ThatAreUp)
+			So(err, ShouldBeNil)
+			s.Stop()
+			So(s.Latest(), ShouldHaveLength, 1)
+			So(s.IsStale(), ShouldBeFalse)
+
+			available = false
+			s, err = e.NewInstanceSetSourceForVIPAddress("testapp", false, true, ThatAreUp)
+			So(err, ShouldBeNil)
+			defer s.Stop()
+			So(s.IsStale(), ShouldBeTrue)
+			instances := s.Latest()
+			So(instances, ShouldHaveLength, 1)
+			So(instances[0].HostName, ShouldEqual, "i-1")
+			So(instances[0].Port, ShouldEqual, 8080)
+			weight, err := instances[0].Metadata.GetInt("weight")
+			So(err, ShouldBeNil)
+			So(weight, ShouldEqual, 10)
+
+			Convey("until a live fetch succeeds", func() {
+				available = true
+				s.update(e.getInstancesByVIPAddress(context.Background(), "testapp", false, instanceQueryOptions{}))
+				So(s.IsStale(), ShouldBeFalse)
+				So(s.Latest(), ShouldHaveLength, 2)
+			})
+		})
+
+		Convey("an app source seeds itself from the snapshot written by an instance set source", func() {
+			s, err := e.NewInstanceSetSourceForApp("TESTAPP", true)
+			So(err, ShouldBeNil)
+			s.Stop()
+
+			available = false
+			a := e.NewAppSource("TESTAPP", true)
+			defer a.Stop()
+			So(a.IsStale(), ShouldBeTrue)
+			So(a.Latest().Instances, ShouldHaveLength, 2)
+		})
+
+		Convey("a registry seeds itself from the last snapshot", func() {
+			e.UseJson = false
+			r := e.NewRegistry(true)
+			r.Stop()
+			So(r.IsStale(), ShouldBeFalse)
+
+			available = false
+			r = e.NewRegistry(true)
+			defer r.Stop()
+			So(r.IsStale(), ShouldBeTrue)
+			instances, err := r.GetInstancesByVIPAddress("testapp", false)
+			So(err, ShouldBeNil)
+			So(instances, ShouldHaveLength, 2)
+		})
+
+		Convey("without a snapshot, a source has nothing to offer while Eureka is down", func() {
+			available = false
+			s, err := e.NewInstanceSetSourceForApp("TESTAPP", true)
+			So(err, ShouldBeNil)
+			defer s.Stop()
+			So(s.Latest(), ShouldBeNil)
+			So(s.IsStale(), ShouldBeFalse)
+		})
+	})
+
+	Convey("Snapshots round-trip through JSON", t, func() {
+		dir, err := os.MkdirTemp("", "fargo-snapshots")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		e := EurekaConnection{SnapshotDir: dir, UseJson: true}
+		ins := &Instance{HostName: "i-1", App: "TESTAPP", Status: UP, Port: 8080, PortEnabled: true}
+		ins.SetMetadataString("weight", "10")
+		path := e.snapshotPath("app", "TESTAPP")
+		So(path, ShouldEndWith, ".json")
+		e.saveSnapshot(path, []*Application{{Name: "TESTAPP", Instances: []*Instance{ins}}})
+		apps, ok := e.loadSnapshot(path)
+		So(ok, ShouldBeTrue)
+		So(apps, ShouldHaveLength, 1)
+		So(apps[0].Instances[0].Port, ShouldEqual, 8080)
+		weight, err := apps[0].Instances[0].Metadata.GetString("weight")
+		So(err, ShouldBeNil)
+		So(weight, ShouldEqual, "10")
+	})
+}
@@ -0,0 +1,47 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"time"
+)
+
+// freshness tracks how current the data held by an AppSource or InstanceSetSource is, deciding
+// whether a source should retain its data when an update attempt fails.
+type freshness struct {
+	// retainFor bounds how long after its last successful update a source retains its data
+	// despite failed update attempts.
+	retainFor    time.Duration
+	lastSuccess  time.Time
+	lastErr      error
+	fromSnapshot bool
+	stale        bool
+}
+
+// seeded notes that the source's data came from a persisted snapshot, which the source retains
+// until an update succeeds.
+func (f *freshness) seeded() {
+	f.fromSnapshot = true
+	f.stale = true
+}
+
+// record notes the outcome of an update attempt, returning true if the source should keep its
+// current data rather than replacing it with the outcome of this attempt.
+func (f *freshness) record(err error) bool {
+	f.lastErr = err
+	if err == nil {
+		f.lastSuccess = time.Now()
+		f.fromSnapshot = false
+		f.stale = false
+		return false
+	}
+	if f.fromSnapshot {
+		return true
+	}
+	if f.retainFor > 0 && !f.lastSuccess.IsZero() && time.Since(f.lastSuccess) <= f.retainFor {
+		f.stale = true
+		return true
+	}
+	f.stale = false
+	return false
+}
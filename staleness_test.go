@@ -0,0 +1,113 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFreshness(t *testing.T) {
+	failure := errors.New("unreachable")
+
+	Convey("Without a retention period, data is discarded on failure", t, func() {
+		var f freshness
+		So(f.record(nil), ShouldBeFalse)
+		So(f.record(failure), ShouldBeFalse)
+		So(f.stale, ShouldBeFalse)
+		So(f.lastErr, ShouldEqual, failure)
+		So(f.lastSuccess, ShouldNotBeZeroValue)
+	})
+
+	Convey("With a retention period", t, func() {
+		f := freshness{retainFor: time.Hour}
+
+		Convey("data is retained on failure", func() {
+			So(f.record(nil), ShouldBeFalse)
+			So(f.record(failure), ShouldBeTrue)
+			So(f.stale, ShouldBeTrue)
+			So(f.record(nil), ShouldBeFalse)
+			So(f.stale, ShouldBeFalse)
+			So(f.lastErr, ShouldBeNil)
+		})
+
+		Convey("data older than the period is discarded", func() {
+			f.record(nil)
+			f.lastSuccess = time.Now().Add(-2 * time.Hour)
+			So(f.record(failure), ShouldBeFalse)
+			So(f.stale, ShouldBeFalse)
+		})
+
+		Convey("nothing is retained before the first success", func() {
+			So(f.record(failure), ShouldBeFalse)
+		})
+	})
+
+	Convey("Data from a snapshot is retained until an update succeeds", t, func() {
+		var f freshness
+		f.seeded()
+		So(f.record(failure), ShouldBeTrue)
+		So(f.stale, ShouldBeTrue)
+		So(f.record(nil), ShouldBeFalse)
+		So(f.stale, ShouldBeFalse)
+		So(f.record(failure), ShouldBeFalse)
+	})
+}
+
+func TestSourcesRetainStaleData(t *testing.T) {
+	var available int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&available) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`<application><name>TESTAPP</name><instance><hostName>i-1</hostName><app>TESTAPP</app><status>UP</status></instance></application>`))
+	}))
+	defer server.Close()
+
+	Convey("Given a connection that retains stale data", t, func() {
+		atomic.StoreInt32(&available, 1)
+		e := NewConn(server.URL)
+		defer e.Close()
+		e.QuarantineDuration = time.Millisecond
+		e.PollInterval = 5 * time.Millisecond
+		e.RetainStaleFor = time.Hour
+		waitForError := func(lastError func() error) {
+			deadline := time.Now().Add(5 * time.Second)
+			for lastError() == nil && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+		}
+
+		Convey("an app source keeps its application when updates fail", func() {
+			s := e.NewAppSource("TESTAPP", true)
+			defer s.Stop()
+			So(s.Latest(), ShouldNotBeNil)
+			So(s.LastSuccess(), ShouldNotBeZeroValue)
+			So(s.IsStale(), ShouldBeFalse)
+			atomic.StoreInt32(&available, 0)
+			waitForError(s.LastError)
+			So(s.LastError(), shouldBearHTTPStatusCode, http.StatusServiceUnavailable)
+			So(s.IsStale(), ShouldBeTrue)
+			So(s.Latest(), ShouldNotBeNil)
+		})
+
+		Convey("an instance set source keeps its instances when updates fail", func() {
+			s, err := e.NewInstanceSetSourceForApp("TESTAPP", true)
+			So(err, ShouldBeNil)
+			defer s.Stop()
+			So(s.Latest(), ShouldHaveLength, 1)
+			atomic.StoreInt32(&available, 0)
+			waitForError(s.LastError)
+			So(s.LastError(), ShouldNotBeNil)
+			So(s.IsStale(), ShouldBeTrue)
+			So(s.Latest(), ShouldHaveLength, 1)
+		})
+	})
+}
@@ -27,6 +27,40 @@ type EurekaConnection struct {
 	DiscoveryZone  string
 	discoveryTtl   chan struct{}
 	UseJson        bool
+	// HTTPClient sends this connection's requests to Eureka. If nil, the connection uses the
+	// package-level HttpClient, shared with all other connections lacking their own client.
+	HTTPClient Doer
+	// ConnectTimeout bounds establishing each connection to a Eureka server through the package's
+	// own HTTP clients, which an HTTPClient supplied here replaces. Timeout, if set, bounds each
+	// request as a whole. When zero, a default of five seconds applies.
+	ConnectTimeout time.Duration
+	// TLS secures this connection's requests to Eureka when it lacks its own HTTPClient.
+	TLS *TLSSettings
+	// Authenticator adds credentials to each request sent to Eureka. If nil, any user name and
+	// password embedded in a service URL are applied using basic authentication.
+	Authenticator Authenticator
+	// QuarantineDuration is how long to avoid a Eureka server after a failed request, doubling
+	// with each consecutive failure up to MaxQuarantineDuration. When zero, the defaults
+	// DefaultQuarantineDuration and DefaultMaxQuarantineDuration apply.
+	QuarantineDuration    time.Duration
+	MaxQuarantineDuration time.Duration
+	servers               *serverTracker
+	// Zone is the availability zone in which this process runs. See LocalZone.
+	Zone string
+	// ZoneServiceUrls groups service URLs by the availability zone of the Eureka servers they
+	// address, allowing a connection that prefers servers in its own zone to identify them.
+	ZoneServiceUrls map[string][]string
+	// EnableDelta allows a RegistryClient to keep its copy of the registry current by fetching only
+	// the changes made since its last fetch, rather than fetching the full registry each time.
+	EnableDelta bool
+	// SnapshotDir names a directory in which AppSources, InstanceSetSources, and Registries persist
+	// the latest data they fetch from Eureka, so that when created again they can start out with
+	// that data should Eureka be unavailable. If empty, no such data is persisted.
+	SnapshotDir string
+	// RetainStaleFor is how long after its last successful update an AppSource or
+	// InstanceSetSource continues to offer its data despite failed update attempts. If zero, a
+	// source discards its data as soon as an update attempt fails.
+	RetainStaleFor time.Duration
 }
 
 // GetAppsResponseJson lets us deserialize the eureka/v2/apps response JSON—a wrapped GetAppsResponse.
@@ -64,6 +98,16 @@ const (
 	UNKNOWN      StatusType = "UNKNOWN"
 )
 
+// ActionType is an enum of the changes to an instance that Eureka reports in a registry delta.
+type ActionType string
+
+// Supported action types
+const (
+	ADDED    ActionType = "ADDED"
+	MODIFIED ActionType = "MODIFIED"
+	DELETED  ActionType = "DELETED"
+)
+
 // Datacenter names
 const (
 	Amazon = "Amazon"
@@ -102,6 +146,10 @@ type Instance struct {
 	LeaseInfo LeaseInfo        `xml:"leaseInfo" json:"leaseInfo"`
 	Metadata  InstanceMetadata `xml:"metadata" json:"metadata"`
 
+	// ActionType indicates how the instance changed, populated only for instances retrieved
+	// in a registry delta.
+	ActionType ActionType `xml:"actionType,omitempty" json:"actionType,omitempty"`
+
 	UniqueID func(i Instance) string `xml:"-" json:"-"`
 }
 
@@ -110,6 +158,9 @@ type Instance struct {
 type InstanceMetadata struct {
 	Raw    []byte `xml:",innerxml" json:"-"`
 	parsed map[string]interface{}
+	// parsedRaw is the value of Raw from which parsed was derived, indicating whether parsed is
+	// current.
+	parsedRaw []byte
 }
 
 // AmazonMetadataType is information about AZ's, AMI's, and the AWS instance.
@@ -35,4 +35,25 @@ func TestConfigs(t *testing.T) {
 		})
 		So(conf.Eureka.UseDNSForServiceUrls, ShouldEqual, false)
 	})
+
+	Convey("Testing a config that connects to Eureka over mutual TLS", t, func() {
+		conf, err := fargo.ReadConfig("./config_sample/tls.gcfg")
+		So(err, ShouldBeNil)
+		So(conf.Eureka.TLSCAFile, ShouldEqual, "/etc/fargo/ca.pem")
+		So(conf.Eureka.TLSCertFile, ShouldEqual, "/etc/fargo/client.pem")
+		So(conf.Eureka.TLSKeyFile, ShouldEqual, "/etc/fargo/client-key.pem")
+		So(conf.Eureka.TLSInsecureSkipVerify, ShouldBeFalse)
+		So(conf.Eureka.TLSServerName, ShouldEqual, "eureka.internal")
+		Convey("The connection should carry those TLS settings", func() {
+			e := fargo.NewConnFromConfig(conf)
+			So(e.TLS, ShouldNotBeNil)
+			So(e.TLS.CAFile, ShouldEqual, conf.Eureka.TLSCAFile)
+			So(e.TLS.ServerName, ShouldEqual, conf.Eureka.TLSServerName)
+		})
+	})
+	Convey("A config without TLS settings yields a connection without them", t, func() {
+		conf, err := fargo.ReadConfig("./config_sample/local.gcfg")
+		So(err, ShouldBeNil)
+		So(fargo.NewConnFromConfig(conf).TLS, ShouldBeNil)
+	})
 }
@@ -0,0 +1,68 @@
+package fargo_test
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hudl/fargo"
+	"github.com/hudl/fargo/fargotest"
+)
+
+// eurekaURLsVar names the environment variable that directs the tests to a real Eureka cluster,
+// such as the one described in docker-compose.yml, at the comma-separated service URLs it holds.
+// When it's empty, the tests run against a fargotest.Server instead.
+const eurekaURLsVar = "FARGO_TEST_EUREKA_URLS"
+
+var (
+	// serviceURLs addresses the Eureka servers under test.
+	serviceURLs []string
+	// registryCacheDelay is how long the Eureka servers under test may take to reflect a change
+	// in the responses they cache.
+	registryCacheDelay time.Duration
+)
+
+func TestMain(m *testing.M) {
+	if urls := os.Getenv(eurekaURLsVar); urls != "" {
+		serviceURLs = strings.Split(urls, ",")
+		registryCacheDelay = 35 * time.Second
+		os.Exit(m.Run())
+	}
+	server := fargotest.NewServer()
+	// Mimic the two Eureka servers of the docker-compose cluster, which register themselves.
+	for _, hostName := range []string{"eureka1", "eureka2"} {
+		server.Register(&fargo.Instance{
+			HostName:       hostName,
+			App:            "EUREKA",
+			IPAddr:         "127.0.0.1",
+			VipAddress:     "eureka",
+			Port:           8080,
+			PortEnabled:    true,
+			DataCenterInfo: fargo.DataCenterInfo{Name: fargo.MyOwn},
+			Status:         fargo.UP,
+			// Never let these leases lapse.
+			LeaseInfo: fargo.LeaseInfo{DurationInSecs: 1 << 30},
+		})
+	}
+	serviceURLs = []string{server.URL()}
+	code := m.Run()
+	server.Close()
+	os.Exit(code)
+}
+
+// netConfig reads the sample configuration for the network tests, pointing it at the Eureka
+// servers under test.
+func netConfig() (fargo.Config, error) {
+	cfg, err := fargo.ReadConfig("./config_sample/net.gcfg")
+	cfg.Eureka.ServiceUrls = serviceURLs
+	return cfg, err
+}
+
+// newNetConn returns a connection to the Eureka servers under test.
+func newNetConn() fargo.EurekaConnection {
+	cfg, _ := netConfig()
+	return fargo.NewConnFromConfig(cfg)
+}
@@ -347,3 +347,35 @@ func TestDataCenterInfoMarshal(t *testing.T) {
 		})
 	})
 }
+
+func TestOverriddenStatusUnmarshal(t *testing.T) {
+	Convey("Given an instance with an overridden status", t, func() {
+		Convey("When the status is spelled \"overriddenstatus\" in JSON", func() {
+			var ins fargo.Instance
+			err := json.Unmarshal([]byte(`{"app":"TESTAPP","status":"OUT_OF_SERVICE","overriddenstatus":"OUT_OF_SERVICE","port":{"$":7101,"@enabled":"true"},"securePort":{"$":7102,"@enabled":"false"}}`), &ins)
+			So(err, ShouldBeNil)
+			So(ins.Overriddenstatus, ShouldEqual, fargo.OUTOFSERVICE)
+		})
+
+		Convey("When the status is spelled \"overriddenStatus\" in JSON", func() {
+			var ins fargo.Instance
+			err := json.Unmarshal([]byte(`{"app":"TESTAPP","status":"OUT_OF_SERVICE","overriddenStatus":"OUT_OF_SERVICE","port":{"$":7101,"@enabled":"true"},"securePort":{"$":7102,"@enabled":"false"}}`), &ins)
+			So(err, ShouldBeNil)
+			So(ins.Overriddenstatus, ShouldEqual, fargo.OUTOFSERVICE)
+		})
+
+		Convey("When the status is spelled \"overriddenstatus\" in XML", func() {
+			var ins fargo.Instance
+			err := xml.Unmarshal([]byte(`<instance><app>TESTAPP</app><overriddenstatus>OUT_OF_SERVICE</overriddenstatus></instance>`), &ins)
+			So(err, ShouldBeNil)
+			So(ins.Overriddenstatus, ShouldEqual, fargo.OUTOFSERVICE)
+		})
+
+		Convey("When the status is spelled \"overriddenStatus\" in XML", func() {
+			var ins fargo.Instance
+			err := xml.Unmarshal([]byte(`<instance><app>TESTAPP</app><overriddenStatus>OUT_OF_SERVICE</overriddenStatus></instance>`), &ins)
+			So(err, ShouldBeNil)
+			So(ins.Overriddenstatus, ShouldEqual, fargo.OUTOFSERVICE)
+		})
+	})
+}
@@ -84,3 +84,35 @@ func TestSerializeMeta(t *testing.T) {
 		})
 	})
 }
+
+func TestSetMetadataString(t *testing.T) {
+	Convey("Given an instance with metadata received from Eureka", t, func() {
+		instance := new(fargo.Instance)
+		instance.Metadata.Raw = []byte("<a>one</a>")
+		Convey("Setting another value", func() {
+			instance.SetMetadataString("b", "two")
+			Convey("Should retain the received value", func() {
+				v, err := instance.Metadata.GetString("a")
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, "one")
+			})
+			Convey("Should make the new value available", func() {
+				v, err := instance.Metadata.GetString("b")
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, "two")
+			})
+			Convey("Should update the raw metadata to match", func() {
+				So(string(instance.Metadata.Raw), ShouldEqual, "<a>one</a><b>two</b>")
+			})
+		})
+	})
+
+	Convey("Given an instance with JSON metadata received from Eureka", t, func() {
+		instance := new(fargo.Instance)
+		instance.Metadata.Raw = []byte(`{"a":"one"}`)
+		Convey("Setting another value should update the raw metadata as JSON", func() {
+			instance.SetMetadataString("b", "two")
+			So(string(instance.Metadata.Raw), ShouldEqual, `{"a":"one","b":"two"}`)
+		})
+	})
+}
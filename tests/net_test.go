@@ -38,6 +38,7 @@ func withCustomRegisteredInstance(e *fargo.EurekaConnection, application string,
 		i := &fargo.Instance{
 			HostName:         hostName,
 			Port:             9090,
+			PortEnabled:      true,
 			App:              application,
 			IPAddr:           "127.0.0.10",
 			VipAddress:       vipAddress,
@@ -87,7 +88,7 @@ func withRegisteredInstance(e *fargo.EurekaConnection, f func(i *fargo.Instance)
 
 func TestConnectionCreation(t *testing.T) {
 	Convey("Pull applications", t, func() {
-		cfg, err := fargo.ReadConfig("./config_sample/net.gcfg")
+		cfg, err := netConfig()
 		So(err, ShouldBeNil)
 		e := fargo.NewConnFromConfig(cfg)
 		apps, err := e.GetApps()
@@ -99,7 +100,7 @@ func TestConnectionCreation(t *testing.T) {
 }
 
 func TestGetApps(t *testing.T) {
-	e, _ := fargo.NewConnFromConfigFile("./config_sample/net.gcfg")
+	e := newNetConn()
 	for _, j := range []bool{false, true} {
 		e.UseJson = j
 		Convey("Pull applications", t, func() {
@@ -123,7 +124,7 @@ func TestGetApps(t *testing.T) {
 }
 
 func TestGetInstancesByNonexistentVIPAddress(t *testing.T) {
-	e, _ := fargo.NewConnFromConfigFile("./config_sample/net.gcfg")
+	e := newNetConn()
 	for _, e.UseJson = range []bool{false, true} {
 		Convey("Get instances by VIP address", t, func() {
 			Convey("when the VIP address has no instances", func() {
@@ -144,8 +145,8 @@ func TestGetSingleInstanceByVIPAddress(t *testing.T) {
 	if testing.Short() {
 		t.SkipNow()
 	}
-	e, _ := fargo.NewConnFromConfigFile("./config_sample/net.gcfg")
-	cacheDelay := 35 * time.Second
+	e := newNetConn()
+	cacheDelay := registryCacheDelay
 	vipAddress := "app"
 	for _, e.UseJson = range []bool{false, true} {
 		Convey("When the VIP address has one instance", t, withRegisteredInstance(&e, func(instance *fargo.Instance) {
@@ -197,8 +198,8 @@ func TestGetMultipleInstancesByVIPAddress(t *testing.T) {
 	if testing.Short() {
 		t.SkipNow()
 	}
-	e, _ := fargo.NewConnFromConfigFile("./config_sample/net.gcfg")
-	cacheDelay := 35 * time.Second
+	e := newNetConn()
+	cacheDelay := registryCacheDelay
 	for _, e.UseJson = range []bool{false, true} {
 		Convey("When the VIP address has one instance", t, withRegisteredInstance(&e, func(instance *fargo.Instance) {
 			Convey("when the VIP address has two instances", withCustomRegisteredInstance(&e, "TESTAPP2", "i-234567", func(_ *fargo.Instance) {
@@ -220,7 +221,7 @@ func TestGetMultipleInstancesByVIPAddress(t *testing.T) {
 }
 
 func TestRegistration(t *testing.T) {
-	e, _ := fargo.NewConnFromConfigFile("./config_sample/net.gcfg")
+	e := newNetConn()
 	i := fargo.Instance{
 		HostName:         "i-123456",
 		Port:             9090,
@@ -264,7 +265,7 @@ func TestRegistration(t *testing.T) {
 }
 
 func TestReregistration(t *testing.T) {
-	e, _ := fargo.NewConnFromConfigFile("./config_sample/net.gcfg")
+	e := newNetConn()
 
 	for _, j := range []bool{false, true} {
 		e.UseJson = j
@@ -310,7 +311,7 @@ func TestReregistration(t *testing.T) {
 }
 
 func DontTestDeregistration(t *testing.T) {
-	e, _ := fargo.NewConnFromConfigFile("./config_sample/net.gcfg")
+	e := newNetConn()
 	i := fargo.Instance{
 		HostName:         "i-123456",
 		Port:             9090,
@@ -342,10 +343,11 @@ func DontTestDeregistration(t *testing.T) {
 }
 
 func TestUpdateStatus(t *testing.T) {
-	e, _ := fargo.NewConnFromConfigFile("./config_sample/net.gcfg")
+	e := newNetConn()
 	i := fargo.Instance{
 		HostName:         "i-123456",
 		Port:             9090,
+		PortEnabled:      true,
 		App:              "TESTAPP",
 		IPAddr:           "127.0.0.10",
 		VipAddress:       "127.0.0.10",
@@ -374,8 +376,54 @@ func TestUpdateStatus(t *testing.T) {
 	}
 }
 
+func TestStatusOverride(t *testing.T) {
+	e := newNetConn()
+	for _, j := range []bool{false, true} {
+		e.UseJson = j
+		Convey("Given a registered instance", t, withRegisteredInstance(&e, func(i *fargo.Instance) {
+			Convey("Overriding its status to OUT_OF_SERVICE succeeds", func() {
+				So(e.UpdateInstanceStatus(i, fargo.OUTOFSERVICE), ShouldBeNil)
+
+				Convey("Eureka reports the override", func() {
+					ii, err := e.GetInstance(i.App, i.Id())
+					So(err, ShouldBeNil)
+					So(ii.Status, ShouldEqual, fargo.OUTOFSERVICE)
+					So(ii.Overriddenstatus, ShouldEqual, fargo.OUTOFSERVICE)
+
+					Convey("Removing the override with a fallback status succeeds", func() {
+						So(e.RemoveStatusOverride(i, fargo.UP), ShouldBeNil)
+
+						Convey("Eureka no longer reports the override", func() {
+							ii, err := e.GetInstance(i.App, i.Id())
+							So(err, ShouldBeNil)
+							So(ii.Status, ShouldEqual, fargo.UP)
+							So(ii.Overriddenstatus, ShouldEqual, fargo.UNKNOWN)
+						})
+					})
+				})
+
+				Convey("Removing the override without a fallback status succeeds", func() {
+					So(e.RemoveStatusOverride(i, ""), ShouldBeNil)
+
+					Convey("Eureka no longer reports the override", func() {
+						ii, err := e.GetInstance(i.App, i.Id())
+						So(err, ShouldBeNil)
+						So(ii.Overriddenstatus, ShouldEqual, fargo.UNKNOWN)
+					})
+				})
+			})
+		}))
+		Convey("Removing the status override of an unregistered instance fails", t, func() {
+			i := fargo.Instance{App: "TESTAPP", HostName: "i-nonexistent"}
+			err := e.RemoveStatusOverride(&i, fargo.UP)
+			So(err, ShouldNotBeNil)
+			So(err, shouldBearHTTPStatusCode, http.StatusNotFound)
+		})
+	}
+}
+
 func TestMetadataReading(t *testing.T) {
-	e, _ := fargo.NewConnFromConfigFile("./config_sample/net.gcfg")
+	e := newNetConn()
 	i := fargo.Instance{
 		HostName:         "i-123456",
 		Port:             9090,
@@ -416,3 +464,41 @@ func TestMetadataReading(t *testing.T) {
 		})
 	}
 }
+
+func TestMetadataUpdates(t *testing.T) {
+	e := newNetConn()
+	for _, j := range []bool{false, true} {
+		e.UseJson = j
+		Convey("Given a registered instance", t, withRegisteredInstance(&e, func(i *fargo.Instance) {
+			Convey("Updating several metadata keys succeeds", func() {
+				err := e.UpdateMetadata(i, map[string]string{"SomeProp": "AValue", "OtherProp": "BValue"})
+				So(err, ShouldBeNil)
+
+				Convey("Eureka reports the new metadata", func() {
+					ii, err := e.GetInstance(i.App, i.Id())
+					So(err, ShouldBeNil)
+					v, err := ii.Metadata.GetString("SomeProp")
+					So(err, ShouldBeNil)
+					So(v, ShouldEqual, "AValue")
+					v, err = ii.Metadata.GetString("OtherProp")
+					So(err, ShouldBeNil)
+					So(v, ShouldEqual, "BValue")
+				})
+
+				Convey("Removing a metadata key succeeds", func() {
+					err := e.RemoveMetadata(i, "SomeProp")
+					So(err, ShouldBeNil)
+
+					Convey("Eureka no longer reports that key", func() {
+						ii, err := e.GetInstance(i.App, i.Id())
+						So(err, ShouldBeNil)
+						v, err := ii.Metadata.GetString("OtherProp")
+						So(err, ShouldBeNil)
+						So(v, ShouldEqual, "BValue")
+						So(ii.Metadata.GetMap(), ShouldNotContainKey, "SomeProp")
+					})
+				})
+			})
+		}))
+	}
+}
@@ -0,0 +1,164 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSSettings describes how a EurekaConnection secures its HTTPS connections to Eureka servers,
+// including which certificate authorities to trust and which certificate to present to servers that
+// demand client authentication.
+//
+// TLSSettings acts as the connection's HTTP client, so it must not be copied after first use. It
+// watches the files it names, and reloads them when they change on disk, allowing certificates to
+// be rotated without restarting the process.
+type TLSSettings struct {
+	// CAFile names a file containing PEM-encoded certificates of the authorities to trust when
+	// verifying Eureka servers' certificates. If empty, the host's root certificate authorities are
+	// trusted.
+	CAFile string
+	// CertFile and KeyFile name files containing a PEM-encoded certificate and private key to
+	// present to Eureka servers that request client authentication. Specify both or neither.
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify disables verification of Eureka servers' certificates.
+	InsecureSkipVerify bool
+	// ServerName overrides the name used both to indicate the desired server via SNI and to verify
+	// the server's certificate. If empty, the host name from the service URL is used.
+	ServerName string
+
+	m        sync.Mutex
+	versions [3]fileVersion
+	client   *http.Client
+}
+
+// fileVersion captures enough detail about a file to notice when it has been replaced.
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFileVersion(name string) (fileVersion, error) {
+	if len(name) == 0 {
+		return fileVersion{}, nil
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		return fileVersion{}, err
+	}
+	return fileVersion{fi.ModTime(), fi.Size()}, nil
+}
+
+func (s *TLSSettings) currentVersions() (versions [3]fileVersion, err error) {
+	for i, name := range []string{s.CAFile, s.CertFile, s.KeyFile} {
+		if versions[i], err = statFileVersion(name); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// ClientConfig loads the files named by these settings, and returns a tls.Config that honors
+// them.
+func (s *TLSSettings) ClientConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         s.ServerName,
+		InsecureSkipVerify: s.InsecureSkipVerify,
+	}
+	if len(s.CAFile) > 0 {
+		pem, err := ioutil.ReadFile(s.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", s.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	switch {
+	case len(s.CertFile) > 0 && len(s.KeyFile) > 0:
+		cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	case len(s.CertFile) > 0 || len(s.KeyFile) > 0:
+		return nil, errors.New("a client certificate requires both a certificate file and a key file")
+	}
+	return cfg, nil
+}
+
+func newTLSClient(cfg *tls.Config) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:           dialContext,
+			ResponseHeaderTimeout: 10 * time.Second,
+			TLSClientConfig:       cfg,
+		},
+		Timeout: HttpClient.Timeout,
+	}
+}
+
+// currentClient returns an HTTP client that honors the latest content of the files named by these
+// settings, loading them again if they've changed since last loaded. If the files can't be
+// reloaded, it continues to use the client built from their previous content, if any.
+func (s *TLSSettings) currentClient() (*http.Client, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	versions, err := s.currentVersions()
+	if err == nil && s.client != nil && versions == s.versions {
+		return s.client, nil
+	}
+	if err == nil {
+		var cfg *tls.Config
+		if cfg, err = s.ClientConfig(); err == nil {
+			if s.client != nil {
+				log.Noticef("Reloaded TLS settings for Eureka connection")
+				s.client.CloseIdleConnections()
+			}
+			s.client = newTLSClient(cfg)
+			s.versions = versions
+			return s.client, nil
+		}
+	}
+	if s.client == nil {
+		log.Errorf("Failed loading TLS settings for Eureka connection, error: %s", err.Error())
+		return nil, err
+	}
+	log.Errorf("Failed reloading TLS settings for Eureka connection, continuing with previous settings, error: %s", err.Error())
+	return s.client, nil
+}
+
+// Do sends an HTTP request using a client that honors these settings, satisfying the Doer
+// interface.
+func (s *TLSSettings) Do(req *http.Request) (*http.Response, error) {
+	client, err := s.currentClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+func tlsSettingsFromConfig(conf eureka) *TLSSettings {
+	if len(conf.TLSCAFile) == 0 && len(conf.TLSCertFile) == 0 && len(conf.TLSKeyFile) == 0 &&
+		!conf.TLSInsecureSkipVerify && len(conf.TLSServerName) == 0 {
+		return nil
+	}
+	return &TLSSettings{
+		CAFile:             conf.TLSCAFile,
+		CertFile:           conf.TLSCertFile,
+		KeyFile:            conf.TLSKeyFile,
+		InsecureSkipVerify: conf.TLSInsecureSkipVerify,
+		ServerName:         conf.TLSServerName,
+	}
+}
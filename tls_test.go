@@ -0,0 +1,187 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fargo test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert, key}
+}
+
+// issueClientCert returns PEM-encoded certificate and key blocks for a client certificate signed
+// by the CA.
+func (ca *testCA) issueClientCert(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "fargo test client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func encodeCertificate(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// writeFileAt writes a file, stamping it with the given modification time so that changes are
+// detectable regardless of the file system's timestamp granularity.
+func writeFileAt(t *testing.T, name string, data []byte, modTime time.Time) {
+	if err := ioutil.WriteFile(name, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSSettings(t *testing.T) {
+	clientCA := newTestCA(t)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello World"))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCA.cert)
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "fargo-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	certPEM, keyPEM := clientCA.issueClientCert(t)
+	modTime := time.Now().Add(-time.Minute)
+	writeFileAt(t, caFile, encodeCertificate(server.Certificate()), modTime)
+	writeFileAt(t, certFile, certPEM, modTime)
+	writeFileAt(t, keyFile, keyPEM, modTime)
+
+	get := func(e *EurekaConnection) (int, error) {
+		req, err := http.NewRequest("GET", server.URL, nil)
+		So(err, ShouldBeNil)
+		_, rcode, err := e.netReq(req)
+		return rcode, err
+	}
+
+	Convey("Given a connection with TLS settings", t, func() {
+		e := &EurekaConnection{
+			TLS: &TLSSettings{
+				CAFile:   caFile,
+				CertFile: certFile,
+				KeyFile:  keyFile,
+			},
+		}
+		Convey("it trusts the server and presents its client certificate", func() {
+			rcode, err := get(e)
+			So(err, ShouldBeNil)
+			So(rcode, ShouldEqual, http.StatusOK)
+		})
+		Convey("it refuses to proceed without both a certificate and a key", func() {
+			e.TLS.KeyFile = ""
+			_, err := get(e)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("it rejects a server signed by an authority it doesn't trust", func() {
+			otherCAFile := filepath.Join(dir, "other-ca.pem")
+			writeFileAt(t, otherCAFile, encodeCertificate(clientCA.cert), modTime)
+			e.TLS.CAFile = otherCAFile
+			_, err := get(e)
+			So(err, ShouldNotBeNil)
+
+			Convey("until the CA file is rotated to trust it", func() {
+				writeFileAt(t, otherCAFile, encodeCertificate(server.Certificate()), modTime.Add(time.Second))
+				rcode, err := get(e)
+				So(err, ShouldBeNil)
+				So(rcode, ShouldEqual, http.StatusOK)
+			})
+		})
+		Convey("it keeps using the last good settings when a rotated file is broken", func() {
+			_, err := get(e)
+			So(err, ShouldBeNil)
+			brokenCAFile := filepath.Join(dir, "broken-ca.pem")
+			writeFileAt(t, brokenCAFile, encodeCertificate(server.Certificate()), modTime)
+			e.TLS.CAFile = brokenCAFile
+			_, err = get(e)
+			So(err, ShouldBeNil)
+			writeFileAt(t, brokenCAFile, []byte("garbage"), modTime.Add(time.Second))
+			rcode, err := get(e)
+			So(err, ShouldBeNil)
+			So(rcode, ShouldEqual, http.StatusOK)
+		})
+	})
+	Convey("Given a connection that skips verification but has no client certificate", t, func() {
+		e := &EurekaConnection{
+			TLS: &TLSSettings{InsecureSkipVerify: true},
+		}
+		Convey("the server rejects it", func() {
+			_, err := get(e)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
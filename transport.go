@@ -0,0 +1,373 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Defaults for a Transport, used when the corresponding TransportOptions field is zero.
+const (
+	// DefaultTransportMaxAttempts is the number of instances to which a Transport sends an
+	// idempotent request before giving up.
+	DefaultTransportMaxAttempts = 3
+	// DefaultTransportMaxHosts is the number of host names for which a Transport tracks the
+	// instances at once.
+	DefaultTransportMaxHosts = 64
+)
+
+// TransportOptions adjusts how a Transport resolves and sends requests. The zero value selects
+// the defaults.
+type TransportOptions struct {
+	// Base sends the requests once their URLs address a chosen instance. It defaults to
+	// http.DefaultTransport.
+	Base http.RoundTripper
+	// ResolveApps directs the Transport to treat the host names in request URLs as Eureka
+	// application names rather than VIP addresses.
+	ResolveApps bool
+	// UseHostName directs the Transport to address instances by their HostName rather than their
+	// IPAddr, as is necessary to verify an instance's TLS certificate.
+	UseHostName bool
+	// MaxAttempts bounds how many instances the Transport tries for an idempotent request that
+	// fails to connect. It defaults to DefaultTransportMaxAttempts.
+	MaxAttempts int
+	// MaxHosts bounds how many host names the Transport tracks at once, each with its own periodic
+	// updates from Eureka. A request for a host beyond that stops the tracking of the host
+	// requested least recently. It defaults to DefaultTransportMaxHosts.
+	MaxHosts int
+	// Balancer adjusts how the Transport chooses among the instances for each host name.
+	Balancer BalancerOptions
+}
+
+// A Transport is an http.RoundTripper that sends each request to an instance registered with
+// Eureka, treating the host name in the request's URL as a VIP address, or, optionally, as an
+// application name. It replaces the URL's host with the chosen instance's address and port,
+// using the instance's SecurePort and secure VIP address for "https" URLs, and its Port and
+// insecure VIP address otherwise.
+//
+// The Transport chooses among the instances that are UP using a Balancer for each host name,
+// reporting a failure to connect as an error against the instance. It sends an idempotent
+// request that fails to connect to another instance, up to the configured number of attempts,
+// but never one that may have reached an instance. ServedBy reports which instance served a
+// response.
+type Transport struct {
+	e           *EurekaConnection
+	base        http.RoundTripper
+	resolveApps bool
+	useHostName bool
+	maxAttempts int
+	maxHosts    int
+	balancing   BalancerOptions
+	m           sync.Mutex
+	balancers   map[transportKey]*transportBalancer
+	// uses counts the requests for each host name, marking when each was requested last.
+	uses uint64
+}
+
+type transportKey struct {
+	host   string
+	secure bool
+}
+
+type transportBalancer struct {
+	*Balancer
+	source   *InstanceSetSource
+	lastUsed uint64
+}
+
+// NewTransport returns a Transport that resolves host names against Eureka over this connection.
+// Close the Transport once it's no longer needed, to halt its periodic updates from Eureka.
+func (e *EurekaConnection) NewTransport(opts TransportOptions) *Transport {
+	t := &Transport{
+		e:           e,
+		base:        opts.Base,
+		resolveApps: opts.ResolveApps,
+		useHostName: opts.UseHostName,
+		maxAttempts: opts.MaxAttempts,
+		maxHosts:    opts.MaxHosts,
+		balancing:   opts.Balancer,
+		balancers:   make(map[transportKey]*transportBalancer),
+	}
+	if t.base == nil {
+		t.base = http.DefaultTransport
+	}
+	if t.maxAttempts <= 0 {
+		t.maxAttempts = DefaultTransportMaxAttempts
+	}
+	if t.maxHosts <= 0 {
+		t.maxHosts = DefaultTransportMaxHosts
+	}
+	return t
+}
+
+type servedByKey struct{}
+
+// ServedBy returns the instance to which a Transport sent the request that elicited the given
+// response, or nil if the response didn't come through a Transport.
+func ServedBy(resp *http.Response) *Instance {
+	if resp == nil || resp.Request == nil {
+		return nil
+	}
+	ins, _ := resp.Request.Context().Value(servedByKey{}).(*Instance)
+	return ins
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	secure := req.URL.Scheme == "https"
+	b, err := t.balancer(req.URL.Hostname(), secure)
+	if err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+	attempts := 1
+	if isRetryable(req) {
+		attempts = t.maxAttempts
+	}
+	tried := make(map[string]bool, attempts)
+	var lastFailure error
+	for attempt := 1; ; attempt++ {
+		ins, err := b.pick(tried)
+		if err != nil {
+			closeRequestBody(req)
+			if lastFailure != nil {
+				// Report why the attempts made so far failed, rather than the lack of other instances.
+				return nil, lastFailure
+			}
+			return nil, fmt.Errorf("choosing an instance for %s: %w", req.URL.Host, err)
+		}
+		tried[ins.Id()] = true
+		out, err := t.rewrite(req, ins, secure, attempt)
+		if err != nil {
+			b.Done(ins, nil)
+			closeRequestBody(req)
+			return nil, err
+		}
+		body := trackBody(out)
+		resp, err := t.base.RoundTrip(out)
+		if err == nil {
+			resp.Request = out
+			if resp.Body == nil {
+				b.Done(ins, nil)
+			} else {
+				resp.Body = &doneOnClose{ReadCloser: resp.Body, done: func() { b.Done(ins, nil) }}
+			}
+			return resp, nil
+		}
+		// Don't hold the instance responsible for a request that its caller abandoned.
+		if req.Context().Err() != nil {
+			b.Done(ins, nil)
+			return nil, err
+		}
+		b.Done(ins, err)
+		// Only a request that never reached the instance is safe to send to another.
+		if attempt >= attempts || !isConnectError(err) || body.wasRead() {
+			return nil, err
+		}
+		log.Warningf("Request to instance %s for %s failed, trying another instance: %s", ins.Id(), req.URL.Host, err)
+		lastFailure = err
+	}
+}
+
+// Close halts the Transport's periodic updates from Eureka. The Transport fails any requests
+// made after it's closed.
+func (t *Transport) Close() {
+	t.m.Lock()
+	defer t.m.Unlock()
+	for _, b := range t.balancers {
+		b.source.Stop()
+	}
+	t.balancers = nil
+}
+
+func (t *Transport) balancer(host string, secure bool) (*transportBalancer, error) {
+	key := transportKey{strings.ToLower(host), secure}
+	t.m.Lock()
+	if t.balancers == nil {
+		t.m.Unlock()
+		return nil, fmt.Errorf("transport for %s is closed", host)
+	}
+	b, ok := t.balancers[key]
+	if ok {
+		t.uses++
+		b.lastUsed = t.uses
+	}
+	t.m.Unlock()
+	if ok {
+		return b, nil
+	}
+
+	// Await the first update outside of the lock, so as not to delay requests for other hosts.
+	var source *InstanceSetSource
+	var err error
+	if t.resolveApps {
+		// Eureka registers application names in upper case.
+		source, err = t.e.NewInstanceSetSourceForApp(strings.ToUpper(key.host), true, ThatAreUp)
+	} else {
+		source, err = t.e.NewInstanceSetSourceForVIPAddress(key.host, secure, true, ThatAreUp)
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.m.Lock()
+	defer t.m.Unlock()
+	if t.balancers == nil {
+		source.Stop()
+		return nil, fmt.Errorf("transport for %s is closed", host)
+	}
+	t.uses++
+	if existing, ok := t.balancers[key]; ok {
+		source.Stop()
+		existing.lastUsed = t.uses
+		return existing, nil
+	}
+	if len(t.balancers) >= t.maxHosts {
+		t.evictLeastRecentlyUsed()
+	}
+	b = &transportBalancer{Balancer: NewBalancer(source, t.balancing), source: source, lastUsed: t.uses}
+	t.balancers[key] = b
+	return b, nil
+}
+
+// evictLeastRecentlyUsed stops tracking the host name requested least recently. Requests in
+// flight to its instances complete unaffected.
+func (t *Transport) evictLeastRecentlyUsed() {
+	var oldest transportKey
+	var found bool
+	for key, b := range t.balancers {
+		if !found || b.lastUsed < t.balancers[oldest].lastUsed {
+			oldest, found = key, true
+		}
+	}
+	if found {
+		log.Debugf("Transport no longer tracking instances for %s", oldest.host)
+		t.balancers[oldest].source.Stop()
+		delete(t.balancers, oldest)
+	}
+}
+
+// rewrite returns a copy of the request addressed to the given instance, carrying the instance
+// in its context for ServedBy.
+func (t *Transport) rewrite(req *http.Request, ins *Instance, secure bool, attempt int) (*http.Request, error) {
+	port := ins.Port
+	if secure {
+		port = ins.SecurePort
+	}
+	if port <= 0 {
+		return nil, fmt.Errorf("instance %s has no port for %s requests", ins.Id(), req.URL.Scheme)
+	}
+	host := ins.IPAddr
+	if t.useHostName || host == "" {
+		host = ins.HostName
+	}
+	out := req.Clone(context.WithValue(req.Context(), servedByKey{}, ins))
+	out.URL.Host = net.JoinHostPort(host, strconv.Itoa(port))
+	// Address the instance in the Host header too, unless the caller chose a Host of its own.
+	if strings.EqualFold((&url.URL{Host: req.Host}).Hostname(), req.URL.Hostname()) {
+		out.Host = ""
+	}
+	if attempt > 1 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		out.Body = body
+	}
+	return out, nil
+}
+
+// isRetryable reports whether a request may be sent again after a failed attempt, per the
+// conventions that http.Transport follows: its method must be idempotent, or it must bear an
+// Idempotency-Key header, and its body, if any, must be available anew.
+func isRetryable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, ok := req.Header["Idempotency-Key"]
+	if !ok {
+		_, ok = req.Header["X-Idempotency-Key"]
+	}
+	return ok
+}
+
+// isConnectError reports whether the error shows that a request failed for want of a connection
+// to the instance, before any of it was sent.
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// sentBody records whether anything has read a request's body.
+type sentBody struct {
+	io.ReadCloser
+	m    sync.Mutex
+	read bool
+}
+
+// trackBody replaces the request's body, if it has one, with a sentBody.
+func trackBody(req *http.Request) *sentBody {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	b := &sentBody{ReadCloser: req.Body}
+	req.Body = b
+	return b
+}
+
+func (b *sentBody) Read(p []byte) (int, error) {
+	b.m.Lock()
+	b.read = true
+	b.m.Unlock()
+	return b.ReadCloser.Read(p)
+}
+
+// wasRead reports whether anything has read the body. A nil sentBody stands for a request
+// without a body, which is never read.
+func (b *sentBody) wasRead() bool {
+	if b == nil {
+		return false
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.read
+}
+
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// doneOnClose calls done the first time its body is closed or read to the end.
+type doneOnClose struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (d *doneOnClose) Read(p []byte) (int, error) {
+	n, err := d.ReadCloser.Read(p)
+	if err == io.EOF {
+		d.once.Do(d.done)
+	}
+	return n, err
+}
+
+func (d *doneOnClose) Close() error {
+	err := d.ReadCloser.Close()
+	d.once.Do(d.done)
+	return err
+}
@@ -0,0 +1,175 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTransport(t *testing.T) {
+	live := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Host", r.Host)
+		fmt.Fprintf(w, "%s %s %s", r.Method, r.URL.Path, body)
+	}))
+	defer live.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	hangUp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer hangUp.Close()
+	port := func(s *httptest.Server) string {
+		u, _ := url.Parse(s.URL)
+		return u.Port()
+	}
+
+	var instances string
+	eureka := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app := "<application><name>TESTAPP</name>" + instances + "</application>"
+		switch r.URL.Path {
+		case "/apps/TESTAPP":
+			w.Write([]byte(app))
+		case "/vips/testapp":
+			w.Write([]byte("<applications>" + app + "</applications>"))
+		default:
+			w.Write([]byte("<applications></applications>"))
+		}
+	}))
+	defer eureka.Close()
+	instance := func(id, port, status string) string {
+		return fmt.Sprintf(`<instance><hostName>%[1]s</hostName><app>TESTAPP</app><ipAddr>127.0.0.1</ipAddr><vipAddress>testapp</vipAddress><status>%[3]s</status><port enabled="true">%[2]s</port></instance>`, id, port, status)
+	}
+
+	Convey("Given a transport resolving VIP addresses", t, func() {
+		instances = instance("i-live", port(live), "UP") + instance("i-down", port(live), "DOWN")
+		e := NewConn(eureka.URL)
+		e.PollInterval = time.Hour
+		transport := e.NewTransport(TransportOptions{})
+		defer transport.Close()
+		client := &http.Client{Transport: transport}
+
+		Convey("a request reaches an instance that is up", func() {
+			resp, err := client.Get("http://testapp/path")
+			So(err, ShouldBeNil)
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			So(string(body), ShouldEqual, "GET /path ")
+			So(ServedBy(resp), ShouldNotBeNil)
+			So(ServedBy(resp).HostName, ShouldEqual, "i-live")
+
+			Convey("and is no longer in flight once its response is read", func() {
+				So(transport.balancers[transportKey{"testapp", false}].InFlight("i-live"), ShouldEqual, 0)
+			})
+
+			Convey("addressing the instance in its Host header", func() {
+				So(resp.Header.Get("X-Host"), ShouldEqual, "127.0.0.1:"+port(live))
+			})
+		})
+
+		Convey("a request keeps a Host header of the caller's choosing", func() {
+			req, _ := http.NewRequest("GET", "http://testapp/path", nil)
+			req.Host = "example.com"
+			resp, err := client.Do(req)
+			So(err, ShouldBeNil)
+			resp.Body.Close()
+			So(resp.Header.Get("X-Host"), ShouldEqual, "example.com")
+		})
+
+		Convey("only so many host names are tracked at once", func() {
+			transport.maxHosts = 1
+			resp, err := client.Get("http://testapp/path")
+			So(err, ShouldBeNil)
+			resp.Body.Close()
+			client.Get("http://otherapp/path")
+			So(transport.balancers, ShouldHaveLength, 1)
+			So(transport.balancers, ShouldContainKey, transportKey{"otherapp", false})
+		})
+
+		Convey("a closed transport fails requests", func() {
+			transport.Close()
+			_, err := client.Get("http://testapp/path")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "closed")
+		})
+
+		Convey("a host with no instances fails", func() {
+			_, err := client.Get("http://otherapp/path")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, ErrNoInstancesAvailable.Error())
+		})
+
+		Convey("a response from elsewhere has no serving instance", func() {
+			So(ServedBy(&http.Response{Request: &http.Request{}}), ShouldBeNil)
+		})
+	})
+
+	Convey("Given a transport with an unreachable instance", t, func() {
+		instances = instance("i-dead", port(dead), "UP") + instance("i-live", port(live), "UP")
+		e := NewConn(eureka.URL)
+		e.PollInterval = time.Hour
+		transport := e.NewTransport(TransportOptions{
+			ResolveApps: true,
+			Balancer:    BalancerOptions{EjectAfter: 1, EjectFor: time.Hour},
+		})
+		defer transport.Close()
+		client := &http.Client{Transport: transport}
+
+		Convey("an idempotent request is retried on another instance", func() {
+			for i := 0; i < 2; i++ {
+				req, _ := http.NewRequest("PUT", "http://TESTAPP/path", strings.NewReader("payload"))
+				resp, err := client.Do(req)
+				So(err, ShouldBeNil)
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				So(string(body), ShouldEqual, "PUT /path payload")
+				So(ServedBy(resp).HostName, ShouldEqual, "i-live")
+			}
+		})
+
+		Convey("a non-idempotent request isn't retried", func() {
+			transport.balancing.Strategy = BalancingStrategyFunc(func(candidates []Candidate) int {
+				return 0
+			})
+			_, err := client.Post("http://testapp/path", "text/plain", strings.NewReader("payload"))
+			So(err, ShouldNotBeNil)
+
+			Convey("though the failing instance is ejected", func() {
+				resp, err := client.Post("http://testapp/path", "text/plain", strings.NewReader("payload"))
+				So(err, ShouldBeNil)
+				resp.Body.Close()
+				So(ServedBy(resp).HostName, ShouldEqual, "i-live")
+			})
+		})
+	})
+
+	Convey("Given a transport with an instance that hangs up on requests", t, func() {
+		instances = instance("i-hang-up", port(hangUp), "UP") + instance("i-live", port(live), "UP")
+		e := NewConn(eureka.URL)
+		e.PollInterval = time.Hour
+		transport := e.NewTransport(TransportOptions{
+			Balancer: BalancerOptions{Strategy: BalancingStrategyFunc(func(candidates []Candidate) int {
+				return 0
+			})},
+		})
+		defer transport.Close()
+		client := &http.Client{Transport: transport}
+
+		Convey("an idempotent request that reached the instance isn't retried", func() {
+			req, _ := http.NewRequest("PUT", "http://testapp/path", strings.NewReader("payload"))
+			_, err := client.Do(req)
+			So(err, ShouldNotBeNil)
+			So(isConnectError(err), ShouldBeFalse)
+		})
+	})
+}
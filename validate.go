@@ -0,0 +1,124 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// InvalidFieldError describes a single field of an Instance that Eureka would reject.
+type InvalidFieldError struct {
+	// Field names the offending field, as in "DataCenterInfo.Name".
+	Field  string
+	Reason string
+}
+
+func (e *InvalidFieldError) Error() string {
+	return e.Field + " " + e.Reason
+}
+
+// InvalidInstanceError reports each field of an Instance that Eureka would reject.
+type InvalidInstanceError struct {
+	Fields []*InvalidFieldError
+}
+
+func (e *InvalidInstanceError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Error()
+	}
+	return fmt.Sprintf("invalid instance: %s", strings.Join(msgs, "; "))
+}
+
+// Validate checks the instance against the rules Eureka applies when registering it, so that
+// mistakes surface with a description rather than as an opaque rejection from the server. If
+// any fields are invalid, it returns an *InvalidInstanceError listing each of them.
+func (i *Instance) Validate() error {
+	var fields []*InvalidFieldError
+	invalid := func(field, format string, args ...interface{}) {
+		fields = append(fields, &InvalidFieldError{field, fmt.Sprintf(format, args...)})
+	}
+
+	if i.App == "" {
+		invalid("App", "is missing")
+	}
+	if i.HostName == "" {
+		invalid("HostName", "is missing")
+	}
+	if i.IPAddr == "" {
+		invalid("IPAddr", "is missing")
+	}
+	if i.VipAddress == "" && i.SecureVipAddress == "" {
+		invalid("VipAddress", "is missing, as is SecureVipAddress")
+	}
+	if !isKnownStatus(i.Status) {
+		invalid("Status", "%q is not a known status", i.Status)
+	}
+	if !isKnownStatus(i.Overriddenstatus) {
+		invalid("Overriddenstatus", "%q is not a known status", i.Overriddenstatus)
+	}
+
+	if i.Port != 0 && !i.PortEnabled {
+		invalid("PortEnabled", "is false although Port is %d", i.Port)
+	}
+	if i.SecurePort != 0 && !i.SecurePortEnabled {
+		invalid("SecurePortEnabled", "is false although SecurePort is %d", i.SecurePort)
+	}
+	if i.PortEnabled && (i.Port <= 0 || i.Port > 65535) {
+		invalid("Port", "%d is not a valid port number", i.Port)
+	}
+	if i.SecurePortEnabled && (i.SecurePort <= 0 || i.SecurePort > 65535) {
+		invalid("SecurePort", "%d is not a valid port number", i.SecurePort)
+	}
+
+	for _, u := range []struct{ field, value string }{
+		{"HomePageUrl", i.HomePageUrl},
+		{"StatusPageUrl", i.StatusPageUrl},
+		{"HealthCheckUrl", i.HealthCheckUrl},
+	} {
+		if u.value == "" {
+			continue
+		}
+		if parsed, err := url.Parse(u.value); err != nil || !parsed.IsAbs() || parsed.Host == "" {
+			invalid(u.field, "%q is not an absolute URL", u.value)
+		}
+	}
+
+	switch dc := i.DataCenterInfo; dc.Name {
+	case "":
+		invalid("DataCenterInfo.Name", "is missing")
+	case Amazon:
+		if dc.Metadata.InstanceID == "" {
+			invalid("DataCenterInfo.Metadata.InstanceID", "is missing")
+		}
+	case MyOwn:
+	default:
+		if dc.Class == "" {
+			invalid("DataCenterInfo.Class", "is missing for custom data center %q", dc.Name)
+		}
+	}
+
+	if i.LeaseInfo.RenewalIntervalInSecs < 0 {
+		invalid("LeaseInfo.RenewalIntervalInSecs", "%d is negative", i.LeaseInfo.RenewalIntervalInSecs)
+	}
+	if i.LeaseInfo.DurationInSecs < 0 {
+		invalid("LeaseInfo.DurationInSecs", "%d is negative", i.LeaseInfo.DurationInSecs)
+	}
+
+	if len(fields) > 0 {
+		return &InvalidInstanceError{fields}
+	}
+	return nil
+}
+
+// isKnownStatus reports whether Eureka recognizes the given status, treating an empty status,
+// which Eureka replaces with its default, as known.
+func isKnownStatus(s StatusType) bool {
+	switch s {
+	case "", UP, DOWN, STARTING, OUTOFSERVICE, UNKNOWN:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// validInstance returns an instance that Eureka would accept for registration.
+func validInstance() *Instance {
+	return &Instance{
+		App:            "TESTAPP",
+		HostName:       "i-123456",
+		IPAddr:         "127.0.0.10",
+		VipAddress:     "testapp",
+		Port:           9090,
+		PortEnabled:    true,
+		Status:         UP,
+		DataCenterInfo: DataCenterInfo{Name: MyOwn},
+	}
+}
+
+func invalidFields(err error) []string {
+	var invalid *InvalidInstanceError
+	if !errors.As(err, &invalid) {
+		return nil
+	}
+	fields := make([]string, len(invalid.Fields))
+	for i, f := range invalid.Fields {
+		fields[i] = f.Field
+	}
+	return fields
+}
+
+func TestValidateInstance(t *testing.T) {
+	Convey("Given a valid instance", t, func() {
+		ins := validInstance()
+
+		Convey("it passes validation", func() {
+			So(ins.Validate(), ShouldBeNil)
+		})
+
+		Convey("missing fields are each reported", func() {
+			ins.App = ""
+			ins.VipAddress = ""
+			ins.DataCenterInfo.Name = ""
+			err := ins.Validate()
+			So(err, ShouldNotBeNil)
+			So(invalidFields(err), ShouldResemble, []string{"App", "VipAddress", "DataCenterInfo.Name"})
+			So(err.Error(), ShouldContainSubstring, "App is missing")
+		})
+
+		Convey("a port that is set but not enabled is reported", func() {
+			ins.PortEnabled = false
+			So(invalidFields(ins.Validate()), ShouldResemble, []string{"PortEnabled"})
+		})
+
+		Convey("a port that is set but not enabled is reported even when the secure port is enabled", func() {
+			ins.PortEnabled = false
+			ins.SecurePort = 443
+			ins.SecurePortEnabled = true
+			So(invalidFields(ins.Validate()), ShouldResemble, []string{"PortEnabled"})
+		})
+
+		Convey("a secure port that is set but not enabled is reported", func() {
+			ins.SecurePort = 443
+			So(invalidFields(ins.Validate()), ShouldResemble, []string{"SecurePortEnabled"})
+			ins.SecurePortEnabled = true
+			So(ins.Validate(), ShouldBeNil)
+		})
+
+		Convey("an instance without any port is fine, as Eureka supplies one", func() {
+			ins.Port = 0
+			ins.PortEnabled = false
+			So(ins.Validate(), ShouldBeNil)
+		})
+
+		Convey("an enabled port out of range is reported", func() {
+			ins.Port = 70000
+			So(invalidFields(ins.Validate()), ShouldResemble, []string{"Port"})
+		})
+
+		Convey("a malformed status and URL are reported", func() {
+			ins.Status = "HEALTHY"
+			ins.HealthCheckUrl = "/health"
+			So(invalidFields(ins.Validate()), ShouldResemble, []string{"Status", "HealthCheckUrl"})
+		})
+
+		Convey("an address that Eureka would accept is fine, even if not an IP address", func() {
+			ins.IPAddr = "localhost"
+			So(ins.Validate(), ShouldBeNil)
+		})
+
+		Convey("an Amazon instance needs its AWS instance ID", func() {
+			ins.DataCenterInfo.Name = Amazon
+			So(invalidFields(ins.Validate()), ShouldResemble, []string{"DataCenterInfo.Metadata.InstanceID"})
+			ins.DataCenterInfo.Metadata.InstanceID = "i-0abc123"
+			So(ins.Validate(), ShouldBeNil)
+		})
+
+		Convey("a custom data center needs a class", func() {
+			ins.DataCenterInfo.Name = "Colo"
+			So(invalidFields(ins.Validate()), ShouldResemble, []string{"DataCenterInfo.Class"})
+		})
+	})
+
+	Convey("Registering an invalid instance fails without contacting Eureka", t, func() {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer server.Close()
+		e := NewConn(server.URL)
+		ins := validInstance()
+		ins.DataCenterInfo.Name = ""
+
+		err := e.RegisterInstance(ins)
+		So(invalidFields(err), ShouldResemble, []string{"DataCenterInfo.Name"})
+		err = e.ReregisterInstance(ins)
+		So(invalidFields(err), ShouldResemble, []string{"DataCenterInfo.Name"})
+		So(requests, ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,156 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"reflect"
+)
+
+// InstanceEventType is an enum of the changes to a set of instances reported by a watch.
+type InstanceEventType int
+
+// Supported instance event types
+const (
+	// InstanceAdded reports an instance that joined the set.
+	InstanceAdded InstanceEventType = iota
+	// InstanceRemoved reports an instance that left the set.
+	InstanceRemoved
+	// InstanceStatusChanged reports an instance whose status changed.
+	InstanceStatusChanged
+	// InstanceMetadataChanged reports an instance whose metadata changed.
+	InstanceMetadataChanged
+)
+
+func (t InstanceEventType) String() string {
+	switch t {
+	case InstanceAdded:
+		return "InstanceAdded"
+	case InstanceRemoved:
+		return "InstanceRemoved"
+	case InstanceStatusChanged:
+		return "InstanceStatusChanged"
+	case InstanceMetadataChanged:
+		return "InstanceMetadataChanged"
+	}
+	return "InstanceEventType(unknown)"
+}
+
+// InstanceEvent describes a change to one instance between two consecutive snapshots of a set of
+// instances, identifying instances by their Id.
+type InstanceEvent struct {
+	Type InstanceEventType
+	// Instance is the instance as it appears in the later snapshot, or, for an InstanceRemoved
+	// event, as it last appeared.
+	Instance *Instance
+	// Previous is the instance as it appeared in the earlier snapshot. It's nil for an
+	// InstanceAdded event.
+	Previous *Instance
+}
+
+// metadataOf returns the instance's parsed metadata, parsing it if necessary without disturbing
+// the instance.
+func metadataOf(ins *Instance) map[string]interface{} {
+	m := ins.Metadata
+	if err := m.parse(); err != nil {
+		return nil
+	}
+	return m.parsed
+}
+
+// DiffInstances compares two snapshots of a set of instances, returning the events that describe
+// how the earlier set became the later one. It reports removed instances first, followed by
+// changed and added instances in the order they appear in the later set. An instance whose
+// status and metadata both changed yields two events.
+func DiffInstances(prev, next []*Instance) []InstanceEvent {
+	prevByID := make(map[string]*Instance, len(prev))
+	for _, ins := range prev {
+		prevByID[ins.Id()] = ins
+	}
+	nextIDs := make(map[string]bool, len(next))
+	for _, ins := range next {
+		nextIDs[ins.Id()] = true
+	}
+	var events []InstanceEvent
+	for _, ins := range prev {
+		if !nextIDs[ins.Id()] {
+			events = append(events, InstanceEvent{InstanceRemoved, ins, ins})
+		}
+	}
+	for _, ins := range next {
+		p, ok := prevByID[ins.Id()]
+		if !ok {
+			events = append(events, InstanceEvent{InstanceAdded, ins, nil})
+			continue
+		}
+		if p.Status != ins.Status {
+			events = append(events, InstanceEvent{InstanceStatusChanged, ins, p})
+		}
+		if !reflect.DeepEqual(metadataOf(p), metadataOf(ins)) {
+			events = append(events, InstanceEvent{InstanceMetadataChanged, ins, p})
+		}
+	}
+	return events
+}
+
+// watchInstanceSetUpdates turns a sequence of instance set updates into the events describing how
+// each successive set differs from the last, treating the first set as having been added in its
+// entirety. It skips failed updates, continuing to compare against the last successful one.
+func watchInstanceSetUpdates(updates <-chan InstanceSetUpdate, done <-chan struct{}) <-chan InstanceEvent {
+	c := make(chan InstanceEvent)
+	go func() {
+		defer close(c)
+		var prev []*Instance
+		for u := range updates {
+			if u.Err != nil {
+				log.Warningf("Failed to update watched instances, error: %s", u.Err.Error())
+				continue
+			}
+			for _, event := range DiffInstances(prev, u.Instances) {
+				select {
+				case c <- event:
+				case <-done:
+					return
+				}
+			}
+			prev = u.Instances
+		}
+	}()
+	return c
+}
+
+// WatchAppInstances starts polling for updates to the set of instances from the Eureka application
+// with the given name, potentially filtered per the constraints supplied as options, using the
+// connection's configured polling interval as its period. It sends an event to the returned
+// channel for each instance added to, removed from, or changed within the set since the preceding
+// poll, initially reporting every instance as added. It continues until the supplied done channel
+// is either closed or has a value available, and then closes the returned channel.
+//
+// If await is true, it completes the first poll before returning.
+//
+// It returns an error if any of the supplied options are invalid, precluding it from scheduling the
+// intended updates.
+func (e *EurekaConnection) WatchAppInstances(name string, await bool, done <-chan struct{}, opts ...InstanceQueryOption) (<-chan InstanceEvent, error) {
+	updates, err := e.ScheduleAppInstanceUpdates(name, await, done, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return watchInstanceSetUpdates(updates, done), nil
+}
+
+// WatchVIPAddress starts polling for updates to the set of instances registered with the given
+// Eureka VIP address, selecting either an insecure or secure VIP address with the given name,
+// potentially filtered per the constraints supplied as options, using the connection's configured
+// polling interval as its period. It sends events to the returned channel as WatchAppInstances
+// does, and continues until the supplied done channel is either closed or has a value available.
+//
+// If await is true, it completes the first poll before returning.
+//
+// It returns an error if any of the supplied options are invalid, precluding it from scheduling the
+// intended updates.
+func (e *EurekaConnection) WatchVIPAddress(addr string, secure bool, await bool, done <-chan struct{}, opts ...InstanceQueryOption) (<-chan InstanceEvent, error) {
+	updates, err := e.ScheduleVIPAddressUpdates(addr, secure, await, done, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return watchInstanceSetUpdates(updates, done), nil
+}
@@ -0,0 +1,126 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDiffInstances(t *testing.T) {
+	withMetadata := func(ins *Instance, raw string) *Instance {
+		ins.Metadata.Raw = []byte(raw)
+		return ins
+	}
+	eventTypes := func(events []InstanceEvent) map[string][]InstanceEventType {
+		types := make(map[string][]InstanceEventType)
+		for _, e := range events {
+			types[e.Instance.Id()] = append(types[e.Instance.Id()], e.Type)
+		}
+		return types
+	}
+
+	Convey("Comparing two sets of instances", t, func() {
+		prev := []*Instance{
+			{HostName: "i-1", Status: UP},
+			{HostName: "i-2", Status: UP},
+			withMetadata(&Instance{HostName: "i-3", Status: UP}, "<weight>1</weight>"),
+			withMetadata(&Instance{HostName: "i-4", Status: UP}, "<weight>1</weight>"),
+		}
+
+		Convey("reports nothing when nothing changed", func() {
+			next := []*Instance{
+				{HostName: "i-2", Status: UP},
+				{HostName: "i-1", Status: UP},
+				withMetadata(&Instance{HostName: "i-3", Status: UP}, "<weight>1</weight>"),
+				withMetadata(&Instance{HostName: "i-4", Status: UP}, "<weight>1</weight>"),
+			}
+			So(DiffInstances(prev, next), ShouldBeEmpty)
+		})
+
+		Convey("reports each kind of change", func() {
+			next := []*Instance{
+				{HostName: "i-2", Status: DOWN},
+				withMetadata(&Instance{HostName: "i-3", Status: UP}, "<weight>2</weight>"),
+				withMetadata(&Instance{HostName: "i-4", Status: OUTOFSERVICE}, "<weight>3</weight>"),
+				{HostName: "i-5", Status: STARTING},
+			}
+			events := DiffInstances(prev, next)
+			So(events[0].Type, ShouldEqual, InstanceRemoved)
+			So(events[0].Instance, ShouldEqual, prev[0])
+			So(eventTypes(events), ShouldResemble, map[string][]InstanceEventType{
+				"i-1": {InstanceRemoved},
+				"i-2": {InstanceStatusChanged},
+				"i-3": {InstanceMetadataChanged},
+				"i-4": {InstanceStatusChanged, InstanceMetadataChanged},
+				"i-5": {InstanceAdded},
+			})
+			So(events[1].Previous, ShouldEqual, prev[1])
+			So(events[1].Instance, ShouldEqual, next[0])
+		})
+
+		Convey("reports every instance as added to an empty set", func() {
+			events := DiffInstances(nil, prev)
+			So(events, ShouldHaveLength, 4)
+			for _, e := range events {
+				So(e.Type, ShouldEqual, InstanceAdded)
+				So(e.Previous, ShouldBeNil)
+			}
+		})
+
+		Convey("leaves unparsed metadata unparsed", func() {
+			next := []*Instance{withMetadata(&Instance{HostName: "i-3", Status: UP}, "<weight>1</weight>")}
+			DiffInstances(prev, next)
+			So(next[0].Metadata.parsed, ShouldBeNil)
+		})
+	})
+}
+
+func TestWatchVIPAddress(t *testing.T) {
+	var status atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<applications><application><name>TESTAPP</name>
+<instance><hostName>i-1</hostName><app>TESTAPP</app><vipAddress>testapp</vipAddress><status>` + status.Load().(string) + `</status></instance>
+</application></applications>`))
+	}))
+	defer server.Close()
+
+	Convey("Watching a VIP address", t, func() {
+		status.Store("UP")
+		e := NewConn(server.URL)
+		e.PollInterval = 10 * time.Millisecond
+		done := make(chan struct{})
+		events, err := e.WatchVIPAddress("testapp", false, true, done)
+		So(err, ShouldBeNil)
+
+		Convey("first reports the existing instances, then their changes", func() {
+			event := <-events
+			So(event.Type, ShouldEqual, InstanceAdded)
+			So(event.Instance.HostName, ShouldEqual, "i-1")
+			status.Store("DOWN")
+			event = <-events
+			So(event.Type, ShouldEqual, InstanceStatusChanged)
+			So(event.Previous.Status, ShouldEqual, UP)
+			So(event.Instance.Status, ShouldEqual, DOWN)
+		})
+
+		Convey("stops once done", func() {
+			close(done)
+			for range events {
+			}
+		})
+
+		Reset(func() {
+			select {
+			case <-done:
+			default:
+				close(done)
+			}
+		})
+	})
+}
@@ -0,0 +1,84 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"os"
+)
+
+// ZoneEnvVar names the environment variable consulted for the local availability zone when a
+// connection's Zone field is empty.
+const ZoneEnvVar = "EUREKA_ZONE"
+
+// LocalZone returns the availability zone in which the connection considers itself to be running:
+// its Zone field if set, or otherwise the value of the environment variable named by ZoneEnvVar.
+func (e *EurekaConnection) LocalZone() string {
+	if len(e.Zone) > 0 {
+		return e.Zone
+	}
+	return os.Getenv(ZoneEnvVar)
+}
+
+// serviceURLZones maps each of the connection's zoned service URLs to its zone.
+func (e *EurekaConnection) serviceURLZones() map[string]string {
+	zones := make(map[string]string)
+	for zone, urls := range e.ZoneServiceUrls {
+		for _, u := range urls {
+			zones[u] = zone
+		}
+	}
+	return zones
+}
+
+// zoneServiceURLsFromConfig maps each configured availability zone to its service URLs. The
+// per-zone service URLs are only available for zones in the us-east-1 region; each is assigned to
+// the configured availability zone with the same zone letter, or else to us-east-1 with that zone
+// letter.
+func zoneServiceURLsFromConfig(conf aws) map[string][]string {
+	byLetter := []struct {
+		letter byte
+		urls   []string
+	}{
+		{'a', conf.ServiceUrlsEast1a},
+		{'b', conf.ServiceUrlsEast1b},
+		{'c', conf.ServiceUrlsEast1c},
+		{'d', conf.ServiceUrlsEast1d},
+		{'e', conf.ServiceUrlsEast1e},
+	}
+	var zones map[string][]string
+	for _, z := range byLetter {
+		if len(z.urls) == 0 {
+			continue
+		}
+		zone := "us-east-1" + string(z.letter)
+		for _, az := range conf.AvailabilityZones {
+			if len(az) > 0 && az[len(az)-1] == z.letter {
+				zone = az
+				break
+			}
+		}
+		if zones == nil {
+			zones = make(map[string][]string)
+		}
+		zones[zone] = append(zones[zone], z.urls...)
+	}
+	return zones
+}
+
+// localZoneFromConfig determines the availability zone in which the process is running: the first
+// configured availability zone, following the Eureka Java client's convention, or the zone reported
+// by the AWS instance metadata service when running in the cloud.
+func localZoneFromConfig(conf Config) string {
+	if len(conf.AWS.AvailabilityZones) > 0 {
+		return conf.AWS.AvailabilityZones[0]
+	}
+	if conf.Eureka.InTheCloud {
+		zone, err := availabilityZone()
+		if err != nil {
+			log.Errorf("Could not retrieve availability zone err=%s", err.Error())
+			return ""
+		}
+		return zone
+	}
+	return ""
+}
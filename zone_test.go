@@ -0,0 +1,108 @@
+package fargo
+
+// MIT Licensed (see README.md) - Copyright (c) 2013 Hudl <@Hudl>
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func selectServiceURL(e *EurekaConnection) string {
+	u, err := e.SelectServiceURL()
+	So(err, ShouldBeNil)
+	return u
+}
+
+func TestZoneAffinity(t *testing.T) {
+	local := []string{"http://eureka1.east1a:8080/eureka/v2", "http://eureka2.east1a:8080/eureka/v2"}
+	remote := []string{"http://eureka1.east1b:8080/eureka/v2", "http://eureka2.east1b:8080/eureka/v2"}
+	newConn := func() EurekaConnection {
+		e := NewConn(append(append([]string{}, remote...), local...)...)
+		e.PreferSameZone = true
+		e.Zone = "us-east-1a"
+		e.ZoneServiceUrls = map[string][]string{
+			"us-east-1a": local,
+			"us-east-1b": remote,
+		}
+		return e
+	}
+
+	Convey("Given a connection that prefers servers in its own zone", t, func() {
+		e := newConn()
+
+		Convey("it selects only servers in that zone", func() {
+			for i := 0; i < 20; i++ {
+				So(local, ShouldContain, selectServiceURL(&e))
+			}
+			candidates, err := e.serviceURLCandidates()
+			So(err, ShouldBeNil)
+			So(local, ShouldContain, candidates[0])
+			So(local, ShouldContain, candidates[1])
+			So(remote, ShouldContain, candidates[2])
+			So(remote, ShouldContain, candidates[3])
+		})
+
+		Convey("it falls back to other zones once the local servers are quarantined", func() {
+			for _, u := range local {
+				e.recordServerFailure(u, errors.New("unreachable"))
+			}
+			candidates, err := e.serviceURLCandidates()
+			So(err, ShouldBeNil)
+			So(remote, ShouldContain, candidates[0])
+			So(remote, ShouldContain, candidates[1])
+			So(local, ShouldContain, candidates[2])
+			So(local, ShouldContain, candidates[3])
+		})
+
+		Convey("it reports each server's zone", func() {
+			for _, s := range e.ServerStates() {
+				if s.Zone == "us-east-1a" {
+					So(local, ShouldContain, s.ServiceURL)
+				} else {
+					So(s.Zone, ShouldEqual, "us-east-1b")
+					So(remote, ShouldContain, s.ServiceURL)
+				}
+			}
+		})
+	})
+
+	Convey("Given a connection without its own zone", t, func() {
+		e := newConn()
+		e.Zone = ""
+
+		Convey("it consults the environment for its zone", func() {
+			defer os.Unsetenv(ZoneEnvVar)
+			os.Setenv(ZoneEnvVar, "us-east-1b")
+			So(e.LocalZone(), ShouldEqual, "us-east-1b")
+			for i := 0; i < 20; i++ {
+				So(remote, ShouldContain, selectServiceURL(&e))
+			}
+		})
+	})
+
+	Convey("Zoned service URLs from a config", t, func() {
+		var conf Config
+		conf.AWS.AvailabilityZones = []string{"us-east-1c", "us-east-1a"}
+		conf.AWS.ServiceUrlsEast1a = local
+		conf.AWS.ServiceUrlsEast1c = remote
+		conf.Eureka.PreferSameZone = true
+
+		Convey("are keyed by their configured zone", func() {
+			So(zoneServiceURLsFromConfig(conf.AWS), ShouldResemble, map[string][]string{
+				"us-east-1a": local,
+				"us-east-1c": remote,
+			})
+		})
+		Convey("become the connection's service URLs", func() {
+			e := NewConnFromConfig(conf)
+			So(e.ServiceUrls, ShouldHaveLength, 4)
+			Convey("with the first configured zone as the local zone", func() {
+				So(e.LocalZone(), ShouldEqual, "us-east-1c")
+				So(remote, ShouldContain, selectServiceURL(&e))
+			})
+		})
+	})
+}